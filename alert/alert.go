@@ -0,0 +1,119 @@
+// Package alert detects sudden changes in repository activity and sends
+// notifications about them
+package alert
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/forstmeier/comana/storage"
+)
+
+// Kinds of activity changes
+const (
+	Spike = "spike"
+	Drop  = "drop"
+)
+
+// Alert describes an hour of repository activity which deviates from its
+// baseline; Score is the deviation in baseline standard deviations
+type Alert struct {
+	Kind     string    `json:"kind"`
+	Repo     string    `json:"repo"`
+	Event    string    `json:"event"`
+	Time     time.Time `json:"time"`
+	Count    int       `json:"count"`
+	Baseline float64   `json:"baseline"`
+	StdDev   float64   `json:"std_dev"`
+	Score    float64   `json:"score"`
+}
+
+// Detector compares hourly counts against the counts of the preceding
+// hours. Threshold is the number of standard deviations a count must
+// differ from the baseline mean by, with the deviation floored at MinStdDev
+// so quiet repositories do not alert on single events; MinCount is the
+// smallest count (for spikes) or mean (for drops) considered.
+type Detector struct {
+	Threshold float64
+	MinStdDev float64
+	MinCount  int
+}
+
+// NewDetector generates a Detector with default sensitivity
+func NewDetector() Detector {
+	return Detector{
+		Threshold: 4,
+		MinStdDev: 1,
+		MinCount:  10,
+	}
+}
+
+// Detect returns the alerts for the counts of the hour at t against the
+// baseline hourly counts, where hours missing a repository count as zero;
+// alerts are ordered by repository and event type
+func (d Detector) Detect(t time.Time, current storage.Counts, baseline []storage.Counts) []Alert {
+	if len(baseline) == 0 {
+		return nil
+	}
+
+	keys := map[[2]string]bool{}
+	for _, counts := range append([]storage.Counts{current}, baseline...) {
+		for repo, events := range counts {
+			for event := range events {
+				keys[[2]string{repo, event}] = true
+			}
+		}
+	}
+
+	alerts := []Alert{}
+	for key := range keys {
+		repo, event := key[0], key[1]
+
+		mean := 0.0
+		for _, counts := range baseline {
+			mean += float64(counts[repo][event])
+		}
+		mean /= float64(len(baseline))
+
+		variance := 0.0
+		for _, counts := range baseline {
+			diff := float64(counts[repo][event]) - mean
+			variance += diff * diff
+		}
+		stdDev := math.Sqrt(variance / float64(len(baseline)))
+
+		count := current[repo][event]
+		score := (float64(count) - mean) / math.Max(stdDev, d.MinStdDev)
+
+		a := Alert{
+			Repo:     repo,
+			Event:    event,
+			Time:     t,
+			Count:    count,
+			Baseline: mean,
+			StdDev:   stdDev,
+			Score:    score,
+		}
+
+		switch {
+		case score >= d.Threshold && count >= d.MinCount:
+			a.Kind = Spike
+		case -score >= d.Threshold && mean >= float64(d.MinCount):
+			a.Kind = Drop
+		default:
+			continue
+		}
+
+		alerts = append(alerts, a)
+	}
+
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].Repo != alerts[j].Repo {
+			return alerts[i].Repo < alerts[j].Repo
+		}
+		return alerts[i].Event < alerts[j].Event
+	})
+
+	return alerts
+}
@@ -0,0 +1,74 @@
+package alert
+
+import (
+	"testing"
+	"time"
+
+	"github.com/forstmeier/comana/storage"
+)
+
+func TestDetect(t *testing.T) {
+	now := time.Date(1977, 5, 25, 20, 0, 0, 0, time.UTC)
+	baseline := []storage.Counts{}
+	for i := 0; i < 24; i++ {
+		baseline = append(baseline, storage.Counts{
+			"luke/x-wing": {"WatchEvent": 2 + i%2, "PushEvent": 30},
+			"han/falcon":  {"WatchEvent": 1},
+		})
+	}
+
+	tests := []struct {
+		desc     string
+		current  storage.Counts
+		baseline []storage.Counts
+		expected []string
+	}{
+		{
+			desc:     "no baseline",
+			current:  storage.Counts{"luke/x-wing": {"WatchEvent": 500}},
+			baseline: nil,
+			expected: []string{},
+		},
+		{
+			desc: "normal activity",
+			current: storage.Counts{
+				"luke/x-wing": {"WatchEvent": 3, "PushEvent": 31},
+				"han/falcon":  {"WatchEvent": 2},
+			},
+			baseline: baseline,
+			expected: []string{},
+		},
+		{
+			desc: "spike and drop",
+			current: storage.Counts{
+				"luke/x-wing": {"WatchEvent": 80},
+				"han/falcon":  {"WatchEvent": 4},
+			},
+			baseline: baseline,
+			expected: []string{"drop luke/x-wing PushEvent", "spike luke/x-wing WatchEvent"},
+		},
+	}
+
+	for _, test := range tests {
+		alerts := NewDetector().Detect(now, test.current, test.baseline)
+
+		received := []string{}
+		for _, a := range alerts {
+			received = append(received, a.Kind+" "+a.Repo+" "+a.Event)
+			if !a.Time.Equal(now) {
+				t.Errorf("description: %s, time received: %s, expected: %s", test.desc, a.Time, now)
+			}
+		}
+
+		if len(received) != len(test.expected) {
+			t.Errorf("description: %s, alerts received: %v, expected: %v", test.desc, received, test.expected)
+			continue
+		}
+
+		for i := range received {
+			if received[i] != test.expected[i] {
+				t.Errorf("description: %s, alerts received: %v, expected: %v", test.desc, received, test.expected)
+			}
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+)
+
+// Notifier sends detected alerts
+type Notifier interface {
+	Notify(alerts []Alert) error
+}
+
+// payload is the JSON document sent by the webhook and SNS notifiers
+type payload struct {
+	Alerts []Alert `json:"alerts"`
+}
+
+// Webhook posts alerts as JSON to a URL
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewWebhook generates a Webhook notifier for the URL
+func NewWebhook(url string) *Webhook {
+	return &Webhook{
+		URL:    url,
+		Client: http.DefaultClient,
+	}
+}
+
+// Notify posts the alerts to the webhook URL
+func (w *Webhook) Notify(alerts []Alert) error {
+	b, err := json.Marshal(payload{
+		Alerts: alerts,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := w.Client.Post(w.URL, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("error posting alerts: %s", err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code %d posting alerts", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// Publisher is the subset of the SNS API used to publish alerts, which
+// also allows SNS-compatible services to be used
+type Publisher interface {
+	Publish(input *sns.PublishInput) (*sns.PublishOutput, error)
+}
+
+// SNS publishes alerts as a JSON message to a topic
+type SNS struct {
+	Publisher Publisher
+	Topic     string
+}
+
+// NewSNS generates an SNS notifier with an active client for the topic ARN
+func NewSNS(topic string) *SNS {
+	return &SNS{
+		Publisher: sns.New(session.New()),
+		Topic:     topic,
+	}
+}
+
+// Notify publishes the alerts to the topic
+func (s *SNS) Notify(alerts []Alert) error {
+	b, err := json.Marshal(payload{
+		Alerts: alerts,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Publisher.Publish(&sns.PublishInput{
+		Message:  aws.String(string(b)),
+		Subject:  aws.String(fmt.Sprintf("comana: %d activity alerts", len(alerts))),
+		TopicArn: aws.String(s.Topic),
+	})
+	if err != nil {
+		return fmt.Errorf("error publishing alerts: %s", err.Error())
+	}
+
+	return nil
+}
+
+// Log writes one line per alert to a logger
+type Log struct {
+	Logger *log.Logger
+}
+
+// Notify writes the alerts to the logger
+func (l *Log) Notify(alerts []Alert) error {
+	for _, a := range alerts {
+		l.Logger.Printf("%s alert: %s %s at %s, count: %d, baseline: %.2f, score: %.2f", a.Kind, a.Repo, a.Event, a.Time.Format("2006-01-02T15"), a.Count, a.Baseline, a.Score)
+	}
+	return nil
+}
+
+// NewFromConfig generates the Notifier for the named kind: "webhook"
+// posting to the target URL, "sns" publishing to the target topic ARN, or
+// "log" writing to the standard logger
+func NewFromConfig(kind, target string) (Notifier, error) {
+	switch kind {
+	case "webhook":
+		return NewWebhook(target), nil
+	case "sns":
+		return NewSNS(target), nil
+	case "log":
+		return &Log{
+			Logger: log.New(os.Stderr, "", log.LstdFlags),
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported alert notifier: %s", kind)
+}
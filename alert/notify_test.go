@@ -0,0 +1,138 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/sns"
+)
+
+var testAlerts = []Alert{
+	{
+		Kind:     Spike,
+		Repo:     "luke/x-wing",
+		Event:    "WatchEvent",
+		Time:     time.Date(1977, 5, 25, 20, 0, 0, 0, time.UTC),
+		Count:    80,
+		Baseline: 2.5,
+		Score:    77.5,
+	},
+}
+
+func TestWebhook(t *testing.T) {
+	tests := []struct {
+		desc   string
+		status int
+		err    string
+	}{
+		{
+			desc:   "rejected delivery",
+			status: http.StatusInternalServerError,
+			err:    "unexpected status code 500 posting alerts",
+		},
+		{
+			desc:   "successful delivery",
+			status: http.StatusOK,
+			err:    "",
+		},
+	}
+
+	for _, test := range tests {
+		received := payload{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&received)
+			w.WriteHeader(test.status)
+		}))
+
+		err := NewWebhook(server.URL).Notify(testAlerts)
+		server.Close()
+
+		if err != nil && err.Error() != test.err {
+			t.Errorf("description: %s, error received: %s, expected: %s", test.desc, err.Error(), test.err)
+		}
+
+		if test.err == "" && err != nil {
+			t.Errorf("description: %s, error received: %s, expected: nil", test.desc, err.Error())
+		}
+
+		if len(received.Alerts) != 1 || received.Alerts[0].Repo != "luke/x-wing" {
+			t.Errorf("description: %s, payload received: %+v", test.desc, received)
+		}
+	}
+}
+
+type publisherMock struct {
+	input *sns.PublishInput
+	err   error
+}
+
+func (p *publisherMock) Publish(input *sns.PublishInput) (*sns.PublishOutput, error) {
+	p.input = input
+	return &sns.PublishOutput{}, p.err
+}
+
+func TestSNS(t *testing.T) {
+	tests := []struct {
+		desc string
+		err  error
+	}{
+		{
+			desc: "publish error",
+			err:  errors.New("publish error"),
+		},
+		{
+			desc: "successful publish",
+			err:  nil,
+		},
+	}
+
+	for _, test := range tests {
+		p := &publisherMock{
+			err: test.err,
+		}
+
+		err := (&SNS{
+			Publisher: p,
+			Topic:     "arn:aws:sns:us-east-1:000000000000:comana",
+		}).Notify(testAlerts)
+
+		if (err != nil) != (test.err != nil) {
+			t.Errorf("description: %s, error received: %v, expected: %v", test.desc, err, test.err)
+		}
+
+		if *p.input.TopicArn != "arn:aws:sns:us-east-1:000000000000:comana" || !strings.Contains(*p.input.Message, `"repo":"luke/x-wing"`) {
+			t.Errorf("description: %s, input received: %+v", test.desc, p.input)
+		}
+	}
+}
+
+func TestLog(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := (&Log{Logger: log.New(buf, "", 0)}).Notify(testAlerts); err != nil {
+		t.Fatalf("description: log alerts, error received: %s", err.Error())
+	}
+
+	expected := "spike alert: luke/x-wing WatchEvent at 1977-05-25T20, count: 80, baseline: 2.50, score: 77.50\n"
+	if buf.String() != expected {
+		t.Errorf("description: log alerts, output received: %q, expected: %q", buf.String(), expected)
+	}
+}
+
+func TestNewFromConfig(t *testing.T) {
+	for _, kind := range []string{"webhook", "sns", "log"} {
+		if _, err := NewFromConfig(kind, "target"); err != nil {
+			t.Errorf("description: %s notifier, error received: %s", kind, err.Error())
+		}
+	}
+
+	if _, err := NewFromConfig("pager", ""); err == nil || err.Error() != "unsupported alert notifier: pager" {
+		t.Errorf("description: unsupported notifier, error received: %v", err)
+	}
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/forstmeier/comana/handlers"
+	"github.com/forstmeier/comana/storage"
+)
+
+type command func(args []string, s storage.Storage, stdout io.Writer) error
+
+var commands = map[string]command{
+	"save":      save,
+	"backfill":  backfill,
+	"job":       job,
+	"reconcile": reconcile,
+	"load":      load,
+	"merge":     merge,
+	"series":    series,
+	"rollup":    rollup,
+	"index":     index,
+	"watch":     watch,
+	"work":      work,
+	"dedupe":    dedupe,
+}
+
+func usage() error {
+	names := []string{}
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return fmt.Errorf("usage: comana <%s> [flags]", strings.Join(names, "|"))
+}
+
+// output prints successful handler responses and converts failures
+func output(resp events.APIGatewayProxyResponse, err error, stdout io.Writer) error {
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != 200 {
+		return errors.New(resp.Body)
+	}
+
+	fmt.Fprintln(stdout, resp.Body)
+	return nil
+}
+
+func save(args []string, s storage.Storage, stdout io.Writer) error {
+	flags := flag.NewFlagSet("save", flag.ContinueOnError)
+	hour := flags.String("hour", "", "archive hour to process, e.g. 2019-01-01T15")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	t, err := time.Parse("2006-01-02T15", *hour)
+	if err != nil {
+		return fmt.Errorf("invalid hour: %s", *hour)
+	}
+
+	req := handlers.Request{
+		Source: "comana.backfill",
+		Year:   t.Year(),
+		Month:  int(t.Month()),
+		Day:    t.Day(),
+		Hour:   t.Hour(),
+	}
+
+	resp, err := handlers.SaveData(req, s)
+	return output(resp, err, stdout)
+}
+
+func backfill(args []string, s storage.Storage, stdout io.Writer) error {
+	flags := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	from := flags.String("from", "", "first hour to process, e.g. 2019-01-01T00 or 2019-01-01")
+	to := flags.String("to", "", "last hour to process, e.g. 2019-01-31T23 or 2019-01-31 for the whole day")
+	resume := flags.String("resume", "", "job to resume, running only its hours which have not succeeded")
+	workers := flags.Int("workers", 0, "hours to process at once, overriding COMANA_BACKFILL_WORKERS")
+	rate := flags.Float64("rate", -1, "invocations to start per second, 0 for no limit, overriding COMANA_BACKFILL_RATE")
+	remote := flags.Bool("lambda", false, "invoke the deployed save lambda instead of saving in process")
+	queue := flags.String("queue", "", "send saves to the SQS queue URL for a worker instead of saving in process")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	body := map[string]interface{}{
+		"from": *from,
+		"to":   *to,
+	}
+	if *resume != "" {
+		body = map[string]interface{}{
+			"resume": *resume,
+		}
+	}
+
+	req, err := backfillRequest(body, *workers, *rate)
+	if err != nil {
+		return err
+	}
+
+	resp, err := handlers.BackfillData(req, invoker(s, *remote, *queue), s)
+	return output(resp, err, stdout)
+}
+
+// backfillRequest builds a request with the body and any worker and rate
+// limits which were set
+func backfillRequest(body map[string]interface{}, workers int, rate float64) (handlers.Request, error) {
+	if workers != 0 {
+		body["workers"] = workers
+	}
+
+	if rate >= 0 {
+		body["rate"] = rate
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return handlers.Request{}, err
+	}
+
+	return handlers.Request{
+		Body: string(b),
+		Headers: map[string]string{
+			"COMANA_SECRET": os.Getenv("COMANA_SECRET"),
+		},
+	}, nil
+}
+
+// invoker returns the deployed save lambda when remote is set, the SQS
+// queue at the queue URL when given, and otherwise saves in process
+func invoker(s storage.Storage, remote bool, queue string) handlers.Invoker {
+	if remote {
+		return handlers.NewInvoke()
+	}
+
+	if queue != "" {
+		return handlers.NewQueueInvoke(handlers.NewSQSQueue(queue))
+	}
+
+	return handlers.NewLocalInvoke(s)
+}
+
+func reconcile(args []string, s storage.Storage, stdout io.Writer) error {
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	from := flags.String("from", "", "first hour to check, defaults to a week before the latest finished hour")
+	to := flags.String("to", "", "last hour to check, defaults to the latest finished hour")
+	report := flags.String("report", "", "report type, defaults to per-repo-count")
+	fill := flags.Bool("fill", false, "backfill the missing hours as a new job")
+	workers := flags.Int("workers", 0, "hours to process at once, overriding COMANA_BACKFILL_WORKERS")
+	rate := flags.Float64("rate", -1, "invocations to start per second, 0 for no limit, overriding COMANA_BACKFILL_RATE")
+	remote := flags.Bool("lambda", false, "invoke the deployed save lambda instead of saving in process")
+	queue := flags.String("queue", "", "send saves to the SQS queue URL for a worker instead of saving in process")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	body := map[string]interface{}{
+		"fill": *fill,
+	}
+
+	for key, value := range map[string]string{"from": *from, "to": *to, "report": *report} {
+		if value != "" {
+			body[key] = value
+		}
+	}
+
+	req, err := backfillRequest(body, *workers, *rate)
+	if err != nil {
+		return err
+	}
+
+	resp, err := handlers.ReconcileData(req, invoker(s, *remote, *queue), s)
+	return output(resp, err, stdout)
+}
+
+func job(args []string, s storage.Storage, stdout io.Writer) error {
+	flags := flag.NewFlagSet("job", flag.ContinueOnError)
+	id := flags.String("id", "", "backfill job to show")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	req := handlers.Request{
+		QueryStringParameters: map[string]string{
+			"id": *id,
+		},
+	}
+
+	resp, err := handlers.JobData(req, s)
+	return output(resp, err, stdout)
+}
+
+func work(args []string, s storage.Storage, stdout io.Writer) error {
+	flags := flag.NewFlagSet("work", flag.ContinueOnError)
+	queue := flags.String("queue", "", "SQS queue URL to drain")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *queue == "" {
+		return errors.New("queue url is required")
+	}
+
+	saved, err := handlers.Drain(handlers.NewSQSQueue(*queue), handlers.NewLocalInvoke(s))
+	fmt.Fprintf(stdout, "saved %d hours\n", saved)
+	return err
+}
+
+// queryRequest builds a request from the report query flags shared by the
+// load and merge commands
+func queryRequest(name string, args []string) (handlers.Request, error) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	params := map[string]*string{
+		"start":  flags.String("start", "", "first hour to include, e.g. 2019-01-01T00"),
+		"end":    flags.String("end", "", "last hour to include, e.g. 2019-01-01T23"),
+		"period": flags.String("period", "", "report period: hour, day, week, or month"),
+		"report": flags.String("report", "", "report type, defaults to per-repo-count"),
+		"repo":   flags.String("repo", "", "comma-separated repositories to include"),
+		"owner":  flags.String("owner", "", "comma-separated repository owners or organizations to include"),
+		"type":   flags.String("type", "", "comma-separated event types to include"),
+	}
+	if name == "load" {
+		params["limit"] = flags.String("limit", "", "maximum number of results per page, defaults to 100")
+		params["cursor"] = flags.String("cursor", "", "cursor returned as next by a previous page")
+		params["mode"] = flags.String("mode", "", "alternative result mode: top or stats")
+		params["n"] = flags.String("n", "", "number of repositories to rank in top mode, defaults to 10")
+		params["bucket"] = flags.String("bucket", "", "series bucket period in stats mode, defaults to day")
+		params["window"] = flags.String("window", "", "moving average buckets in stats mode, defaults to 7")
+		params["horizon"] = flags.String("horizon", "", "forecast buckets in stats mode, defaults to 4")
+	}
+	if err := flags.Parse(args); err != nil {
+		return handlers.Request{}, err
+	}
+
+	req := handlers.Request{
+		QueryStringParameters: map[string]string{},
+	}
+	for key, value := range params {
+		if *value != "" {
+			req.QueryStringParameters[key] = *value
+		}
+	}
+
+	return req, nil
+}
+
+func load(args []string, s storage.Storage, stdout io.Writer) error {
+	req, err := queryRequest("load", args)
+	if err != nil {
+		return err
+	}
+
+	resp, err := handlers.LoadData(req, s)
+	return output(resp, err, stdout)
+}
+
+func merge(args []string, s storage.Storage, stdout io.Writer) error {
+	req, err := queryRequest("merge", args)
+	if err != nil {
+		return err
+	}
+
+	resp, err := handlers.MergeData(req, s)
+	return output(resp, err, stdout)
+}
+
+func series(args []string, s storage.Storage, stdout io.Writer) error {
+	flags := flag.NewFlagSet("series", flag.ContinueOnError)
+	params := map[string]*string{
+		"repo":   flags.String("repo", "", "repository to return the series for"),
+		"bucket": flags.String("bucket", "", "bucket period: hour, day, week, or month, defaults to day"),
+		"start":  flags.String("start", "", "first hour to include, defaults to four weeks before end"),
+		"end":    flags.String("end", "", "last hour to include, e.g. 2019-01-01T23"),
+		"report": flags.String("report", "", "report type, defaults to per-repo-count"),
+		"type":   flags.String("type", "", "comma-separated event types to include"),
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	req := handlers.Request{
+		QueryStringParameters: map[string]string{},
+	}
+	for key, value := range params {
+		if *value != "" {
+			req.QueryStringParameters[key] = *value
+		}
+	}
+
+	resp, err := handlers.SeriesData(req, s)
+	return output(resp, err, stdout)
+}
+
+func rollup(args []string, s storage.Storage, stdout io.Writer) error {
+	flags := flag.NewFlagSet("rollup", flag.ContinueOnError)
+	day := flags.String("day", "", "day to roll up along with its week and month, e.g. 2019-01-01")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	t, err := time.Parse("2006-01-02", *day)
+	if err != nil {
+		return fmt.Errorf("invalid day: %s", *day)
+	}
+
+	req := handlers.Request{
+		Source: "comana.rollup",
+		Year:   t.Year(),
+		Month:  int(t.Month()),
+		Day:    t.Day(),
+	}
+
+	resp, err := handlers.RollupData(req, s)
+	return output(resp, err, stdout)
+}
+
+func index(args []string, s storage.Storage, stdout io.Writer) error {
+	flags := flag.NewFlagSet("index", flag.ContinueOnError)
+	day := flags.String("day", "", "day to index, e.g. 2019-01-01")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	t, err := time.Parse("2006-01-02", *day)
+	if err != nil {
+		return fmt.Errorf("invalid day: %s", *day)
+	}
+
+	req := handlers.Request{
+		Source: "comana.index",
+		Year:   t.Year(),
+		Month:  int(t.Month()),
+		Day:    t.Day(),
+	}
+
+	resp, err := handlers.IndexData(req, s)
+	return output(resp, err, stdout)
+}
+
+func watch(args []string, s storage.Storage, stdout io.Writer) error {
+	flags := flag.NewFlagSet("watch", flag.ContinueOnError)
+	name := flags.String("name", "", "watchlist to show or change, all watchlists are listed when empty")
+	repo := flags.String("repo", "", "comma-separated repositories to add or remove")
+	owner := flags.String("owner", "", "comma-separated owners or organizations to add or remove")
+	remove := flags.Bool("remove", false, "remove the repositories and owners, or the whole watchlist when none are provided")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	req := handlers.Request{
+		HTTPMethod: "GET",
+		Headers: map[string]string{
+			"COMANA_SECRET": os.Getenv("COMANA_SECRET"),
+		},
+		QueryStringParameters: map[string]string{
+			"name": *name,
+		},
+	}
+
+	split := func(value string) []string {
+		if value == "" {
+			return nil
+		}
+		return strings.Split(value, ",")
+	}
+
+	if *name != "" && (*repo != "" || *owner != "" || *remove) {
+		b, err := json.Marshal(map[string]interface{}{
+			"name":   *name,
+			"repos":  split(*repo),
+			"owners": split(*owner),
+		})
+		if err != nil {
+			return err
+		}
+
+		req.HTTPMethod = "POST"
+		if *remove {
+			req.HTTPMethod = "DELETE"
+		}
+		req.Body = string(b)
+	}
+
+	resp, err := handlers.WatchData(req, s)
+	return output(resp, err, stdout)
+}
+
+func dedupe(args []string, s storage.Storage, stdout io.Writer) error {
+	flags := flag.NewFlagSet("dedupe", flag.ContinueOnError)
+	prefix := flags.String("prefix", "", "key prefix to migrate, e.g. 2019/01")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	removed, err := storage.Deduplicate(s, *prefix)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "removed %d duplicate or legacy report files\n", removed)
+	return nil
+}
+
+func run(args []string, s storage.Storage, stdout io.Writer) error {
+	if len(args) == 0 {
+		return usage()
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return usage()
+	}
+
+	return cmd(args[1:], s, stdout)
+}
+
+func main() {
+	s, err := storage.NewFromConfig(os.Getenv("COMANA_STORAGE"), os.Getenv("COMANA_STORAGE_LOCATION"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if err := run(os.Args[1:], s, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
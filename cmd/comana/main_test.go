@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/forstmeier/comana/storage"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(ioutil.Discard)
+	os.Exit(m.Run())
+}
+
+func Test_run(t *testing.T) {
+	s := storage.NewMemory("")
+	if err := s.PutFile(1977, 5, 25, 20, "per-repo-count", strings.NewReader(`{"luke/x-wing":{"PushEvent":1}}`)); err != nil {
+		t.Fatalf("error creating test report: %s", err.Error())
+	}
+
+	tests := []struct {
+		desc   string
+		args   []string
+		output string
+		err    string
+	}{
+		{
+			desc:   "no command",
+			args:   []string{},
+			output: "",
+			err:    "usage: comana <backfill|dedupe|index|job|load|merge|reconcile|rollup|save|series|watch|work> [flags]",
+		},
+		{
+			desc:   "unknown command",
+			args:   []string{"destroy"},
+			output: "",
+			err:    "usage: comana <backfill|dedupe|index|job|load|merge|reconcile|rollup|save|series|watch|work> [flags]",
+		},
+		{
+			desc:   "save invalid hour",
+			args:   []string{"save", "--hour", "1977-05-25"},
+			output: "",
+			err:    "invalid hour: 1977-05-25",
+		},
+		{
+			desc:   "backfill reversed range",
+			args:   []string{"backfill", "--from", "1977-05-25", "--to", "1977-05-24"},
+			output: "",
+			err:    "to must not be before from",
+		},
+		{
+			desc:   "backfill before gh archive",
+			args:   []string{"backfill", "--from", "1977-05-25", "--to", "1977-05-25"},
+			output: "",
+			err:    "from must not be before 2011-02-12T00 when gh archive begins",
+		},
+		{
+			desc:   "rollup invalid day",
+			args:   []string{"rollup", "--day", "yesterday"},
+			output: "",
+			err:    "invalid day: yesterday",
+		},
+		{
+			desc:   "rollup day",
+			args:   []string{"rollup", "--day", "1977-05-25"},
+			output: "success",
+			err:    "",
+		},
+		{
+			desc:   "merge reports",
+			args:   []string{"merge", "--start", "1977-05-25T00", "--end", "1977-05-25T23", "--owner", "luke"},
+			output: `"files":1`,
+			err:    "",
+		},
+		{
+			desc:   "series for repo",
+			args:   []string{"series", "--repo", "luke/x-wing", "--bucket", "hour", "--start", "1977-05-25T20", "--end", "1977-05-25T20"},
+			output: `"total":1`,
+			err:    "",
+		},
+		{
+			desc:   "index day",
+			args:   []string{"index", "--day", "1977-05-25"},
+			output: "success",
+			err:    "",
+		},
+		{
+			desc:   "load top repositories",
+			args:   []string{"load", "--mode", "top", "--start", "1977-05-25", "--n", "1"},
+			output: `"top":[{"repo":"luke/x-wing","count":1`,
+			err:    "",
+		},
+		{
+			desc:   "watch repository",
+			args:   []string{"watch", "--name", "rebels", "--repo", "luke/x-wing"},
+			output: `{"name":"rebels","repos":["luke/x-wing"],"owners":[]}`,
+			err:    "",
+		},
+		{
+			desc:   "list watchlists",
+			args:   []string{"watch"},
+			output: `{"watchlists":[{"name":"rebels"`,
+			err:    "",
+		},
+		{
+			desc:   "reconcile missing hours",
+			args:   []string{"reconcile", "--from", "2019-05-25T20", "--to", "2019-05-25T21"},
+			output: `"missing":["2019-05-25T20:00:00Z","2019-05-25T21:00:00Z"]`,
+			err:    "",
+		},
+		{
+			desc:   "work missing queue",
+			args:   []string{"work"},
+			output: "",
+			err:    "queue url is required",
+		},
+		{
+			desc:   "job invalid id",
+			args:   []string{"job", "--id", "unknown"},
+			output: "",
+			err:    "invalid job id: unknown",
+		},
+		{
+			desc:   "dedupe reports",
+			args:   []string{"dedupe", "--prefix", "1977/05"},
+			output: "removed 0 duplicate or legacy report files",
+			err:    "",
+		},
+		{
+			desc:   "load reports",
+			args:   []string{"load", "--start", "1977-05-25T00", "--end", "1977-05-25T23", "--repo", "luke/x-wing"},
+			output: `"luke/x-wing":{"PushEvent":1}`,
+			err:    "",
+		},
+	}
+
+	for _, test := range tests {
+		stdout := &bytes.Buffer{}
+
+		err := run(test.args, s, stdout)
+		if err != nil && err.Error() != test.err {
+			t.Errorf("description: %s, error received: %s, expected: %s", test.desc, err.Error(), test.err)
+		}
+
+		if err == nil && test.err != "" {
+			t.Errorf("description: %s, no error received, expected: %s", test.desc, test.err)
+		}
+
+		if !strings.Contains(stdout.String(), test.output) {
+			t.Errorf("description: %s, output received: %s, expected: %s", test.desc, stdout.String(), test.output)
+		}
+	}
+}
@@ -10,3 +10,39 @@ aws lambda update-function-code --function-name comana-load --zip-file fileb://c
 go build -ldflags "-X main.HANDLER=BACKFILL" -o lambdabackfill
 zip comana-backfill.zip lambdabackfill
 aws lambda update-function-code --function-name comana-backfill --zip-file fileb://comana-backfill.zip --region us-east-1
+
+go build -ldflags "-X main.HANDLER=ROLLUP" -o lambdarollup
+zip comana-rollup.zip lambdarollup
+aws lambda update-function-code --function-name comana-rollup --zip-file fileb://comana-rollup.zip --region us-east-1
+
+go build -ldflags "-X main.HANDLER=MERGE" -o lambdamerge
+zip comana-merge.zip lambdamerge
+aws lambda update-function-code --function-name comana-merge --zip-file fileb://comana-merge.zip --region us-east-1
+
+go build -ldflags "-X main.HANDLER=SERIES" -o lambdaseries
+zip comana-series.zip lambdaseries
+aws lambda update-function-code --function-name comana-series --zip-file fileb://comana-series.zip --region us-east-1
+
+go build -ldflags "-X main.HANDLER=INDEX" -o lambdaindex
+zip comana-index.zip lambdaindex
+aws lambda update-function-code --function-name comana-index --zip-file fileb://comana-index.zip --region us-east-1
+
+go build -ldflags "-X main.HANDLER=WATCH" -o lambdawatch
+zip comana-watch.zip lambdawatch
+aws lambda update-function-code --function-name comana-watch --zip-file fileb://comana-watch.zip --region us-east-1
+
+go build -ldflags "-X main.HANDLER=SUBSCRIBE" -o lambdasubscribe
+zip comana-subscribe.zip lambdasubscribe
+aws lambda update-function-code --function-name comana-subscribe --zip-file fileb://comana-subscribe.zip --region us-east-1
+
+go build -ldflags "-X main.HANDLER=JOB" -o lambdajob
+zip comana-job.zip lambdajob
+aws lambda update-function-code --function-name comana-job --zip-file fileb://comana-job.zip --region us-east-1
+
+go build -ldflags "-X main.HANDLER=RECONCILE" -o lambdareconcile
+zip comana-reconcile.zip lambdareconcile
+aws lambda update-function-code --function-name comana-reconcile --zip-file fileb://comana-reconcile.zip --region us-east-1
+
+go build -ldflags "-X main.HANDLER=WORK" -o lambdawork
+zip comana-work.zip lambdawork
+aws lambda update-function-code --function-name comana-work --zip-file fileb://comana-work.zip --region us-east-1
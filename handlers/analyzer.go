@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"sort"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/forstmeier/comana/storage"
+)
+
+// Analyzer consumes valid archive event lines and produces the counts for
+// a single report type
+type Analyzer interface {
+	Analyze(line []byte)
+	Counts() storage.Counts
+}
+
+// analyzers holds constructors for fresh analyzers keyed by report type
+var analyzers = map[string]func() Analyzer{}
+
+// RegisterAnalyzer adds an analyzer under the report type name; SaveData
+// feeds every registered analyzer during its single pass over an archive
+// and saves one report per analyzer. Registration is not synchronized and
+// should happen during program initialization.
+func RegisterAnalyzer(name string, fn func() Analyzer) {
+	analyzers[name] = fn
+}
+
+func init() {
+	RegisterAnalyzer(defaultReport, func() Analyzer {
+		return &repoCounts{
+			counts: storage.Counts{},
+		}
+	})
+
+	RegisterAnalyzer(metricsReport, func() Analyzer {
+		return newMetrics()
+	})
+
+	RegisterAnalyzer(ownerReport, func() Analyzer {
+		return &ownerCounts{
+			counts: storage.Counts{},
+		}
+	})
+}
+
+// reportNames returns the sorted report types of all registered analyzers
+func reportNames() []string {
+	names := []string{}
+	for name := range analyzers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validEvent reports whether the line is an event with a type and repository
+func validEvent(line []byte) bool {
+	if !gjson.ValidBytes(line) {
+		return false
+	}
+
+	values := gjson.GetManyBytes(line, "type", "repo.name")
+	return values[0].String() != "" && values[1].String() != ""
+}
+
+// repoCounts counts events by type per repository
+type repoCounts struct {
+	counts storage.Counts
+}
+
+func (r *repoCounts) Analyze(line []byte) {
+	values := gjson.GetManyBytes(line, "type", "repo.name")
+	event, repo := values[0].String(), values[1].String()
+
+	if _, repoExists := r.counts[repo]; !repoExists {
+		r.counts[repo] = map[string]int{}
+	}
+	r.counts[repo][event]++
+}
+
+func (r *repoCounts) Counts() storage.Counts {
+	return r.counts
+}
+
+// ownerReport is the report type holding event counts per organization
+const ownerReport = "per-owner-count"
+
+// ownerCounts counts events by type per organization, falling back to the
+// repository owner for events without an organization
+type ownerCounts struct {
+	counts storage.Counts
+}
+
+func (o *ownerCounts) Analyze(line []byte) {
+	values := gjson.GetManyBytes(line, "type", "repo.name", "org.login")
+	event, owner := values[0].String(), values[2].String()
+	if owner == "" {
+		owner = storage.Owner(values[1].String())
+	}
+
+	if _, ownerExists := o.counts[owner]; !ownerExists {
+		o.counts[owner] = map[string]int{}
+	}
+	o.counts[owner][event]++
+}
+
+func (o *ownerCounts) Counts() storage.Counts {
+	return o.counts
+}
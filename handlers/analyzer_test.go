@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/forstmeier/comana/storage"
+)
+
+type lineAnalyzer struct {
+	lines int
+}
+
+func (l *lineAnalyzer) Analyze(line []byte) {
+	l.lines++
+}
+
+func (l *lineAnalyzer) Counts() storage.Counts {
+	return storage.Counts{
+		"all": {
+			"lines": l.lines,
+		},
+	}
+}
+
+func TestRegisterAnalyzer(t *testing.T) {
+	RegisterAnalyzer("test-report", func() Analyzer {
+		return &lineAnalyzer{}
+	})
+	defer delete(analyzers, "test-report")
+
+	expected := []string{"per-owner-count", "per-repo-count", "per-repo-metrics", "test-report"}
+	if names := reportNames(); !reflect.DeepEqual(names, expected) {
+		t.Errorf("description: registered names, output received: %v, expected: %v", names, expected)
+	}
+
+	input := `{"type": "PushEvent", "repo":{"name": "test-repo"}}` + "\n" + `not-json` + "\n" + `{"type": "WatchEvent", "repo":{"name": "test-repo"}}`
+	output, err := parse(bufio.NewReader(strings.NewReader(input)))
+	if err != nil {
+		t.Fatalf("description: parse with registered analyzer, error received: %s", err.Error())
+	}
+
+	if len(output) != len(expected) {
+		t.Errorf("description: parse with registered analyzer, reports received: %d, expected: %d", len(output), len(expected))
+	}
+
+	file := storage.File{}
+	if err := json.NewDecoder(output["test-report"]).Decode(&file); err != nil {
+		t.Fatalf("description: parse with registered analyzer, error decoding output: %s", err.Error())
+	}
+
+	if file.Parsed != 2 || file.Skipped != 1 || file.Counts["all"]["lines"] != 2 {
+		t.Errorf("description: parse with registered analyzer, output received: %+v", file)
+	}
+}
+
+func Test_validEvent(t *testing.T) {
+	tests := []struct {
+		desc  string
+		line  string
+		valid bool
+	}{
+		{
+			desc:  "invalid json",
+			line:  `{"type": "PushEv`,
+			valid: false,
+		},
+		{
+			desc:  "missing repository",
+			line:  `{"type": "PushEvent"}`,
+			valid: false,
+		},
+		{
+			desc:  "valid event",
+			line:  `{"type": "PushEvent", "repo":{"name": "test-repo"}}`,
+			valid: true,
+		},
+	}
+
+	for _, test := range tests {
+		if valid := validEvent([]byte(test.line)); valid != test.valid {
+			t.Errorf("description: %s, received: %t, expected: %t", test.desc, valid, test.valid)
+		}
+	}
+}
+
+func Test_repoCounts(t *testing.T) {
+	r := &repoCounts{
+		counts: storage.Counts{},
+	}
+
+	r.Analyze([]byte(`{"type": "PushEvent", "repo":{"name": "test-repo"}}`))
+	r.Analyze([]byte(`{"type": "PushEvent", "repo":{"name": "test-repo"}}`))
+	r.Analyze([]byte(`{"type": "WatchEvent", "repo":{"name": "other-repo"}}`))
+
+	expected := storage.Counts{
+		"test-repo": {
+			"PushEvent": 2,
+		},
+		"other-repo": {
+			"WatchEvent": 1,
+		},
+	}
+
+	if output := r.Counts(); !reflect.DeepEqual(output, expected) {
+		t.Errorf("description: repository counts, output received: %+v, expected: %+v", output, expected)
+	}
+}
+
+func Test_ownerCounts(t *testing.T) {
+	o := &ownerCounts{
+		counts: storage.Counts{},
+	}
+
+	o.Analyze([]byte(`{"type": "PushEvent", "repo":{"name": "kubernetes/kubernetes"}, "org":{"login": "kubernetes"}}`))
+	o.Analyze([]byte(`{"type": "PushEvent", "repo":{"name": "kubernetes/test-infra"}}`))
+	o.Analyze([]byte(`{"type": "WatchEvent", "repo":{"name": "luke/x-wing"}}`))
+
+	expected := storage.Counts{
+		"kubernetes": {
+			"PushEvent": 2,
+		},
+		"luke": {
+			"WatchEvent": 1,
+		},
+	}
+
+	if output := o.Counts(); !reflect.DeepEqual(output, expected) {
+		t.Errorf("description: owner counts, output received: %+v, expected: %+v", output, expected)
+	}
+}
@@ -5,14 +5,18 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"os"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/lambda"
 	"github.com/tidwall/gjson"
+
+	"github.com/forstmeier/comana/storage"
 )
 
 // Invoker wraps logic for triggering a Lambda
@@ -20,102 +24,453 @@ type Invoker interface {
 	Invoke(payload []byte) (int64, string, error)
 }
 
+type lambdaAPI interface {
+	Invoke(input *lambda.InvokeInput) (*lambda.InvokeOutput, error)
+}
+
 type client struct {
-	lambda *lambda.Lambda
+	lambda   lambdaAPI
+	function string
+	async    bool
 }
 
 func (i *client) Invoke(payload []byte) (int64, string, error) {
 	input := &lambda.InvokeInput{
-		FunctionName: aws.String("comana-save"),
+		FunctionName: aws.String(i.function),
 		Payload:      payload,
 	}
 
+	if i.async {
+		input.InvocationType = aws.String(lambda.InvocationTypeEvent)
+	}
+
 	result, err := i.lambda.Invoke(input)
-	return *result.StatusCode, string(result.Payload), err
+	if err != nil {
+		return 0, "", err
+	}
+
+	return aws.Int64Value(result.StatusCode), string(result.Payload), nil
 }
 
 // NewInvoke generates an Invoke implementation with an active client
+// synchronously invoking the comana-save function
 func NewInvoke() Invoker {
+	return NewLambdaInvoke("comana-save", false)
+}
+
+// NewLambdaInvoke generates an Invoke implementation with an active client
+// invoking the named function; async invocations are queued by Lambda and
+// return once accepted, so save errors are not reported to the caller
+func NewLambdaInvoke(function string, async bool) Invoker {
 	return &client{
-		lambda: lambda.New(session.New()),
+		lambda:   lambda.New(session.New()),
+		function: function,
+		async:    async,
 	}
 }
 
-// BackfillData pulls in historic data for stat updates
-func BackfillData(req Request, client Invoker) (events.APIGatewayProxyResponse, error) {
-	log.Printf("backfill request: %s", req.Body)
+type local struct {
+	storage storage.Storage
+}
 
-	if req.Headers["COMANA_SECRET"] != os.Getenv("COMANA_SECRET") {
-		return events.APIGatewayProxyResponse{
-			StatusCode:      500,
-			Body:            "incorrect secret received: " + req.Headers["COMANA_SECRET"],
-			IsBase64Encoded: false,
-		}, errors.New("incorrect secret received: " + req.Headers["COMANA_SECRET"])
+func (l *local) Invoke(payload []byte) (int64, string, error) {
+	req := Request{}
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return 500, "", err
 	}
 
-	year := gjson.Get(req.Body, "year").Int()
-	month := gjson.Get(req.Body, "month").Int()
-	startDay := gjson.Get(req.Body, "start_day").Int()
-	endDay := gjson.Get(req.Body, "end_day").Int()
-	log.Printf("year: %d, month: %d, start day: %d, end day: %d", year, month, startDay, endDay)
+	resp, err := SaveData(req, l.storage)
+	return int64(resp.StatusCode), resp.Body, err
+}
 
-	finished := make(chan bool, 1)
-	errs := make(chan error, 1)
-	var wg sync.WaitGroup
+// NewLocalInvoke generates an Invoke implementation running SaveData in
+// process against the provided storage
+func NewLocalInvoke(s storage.Storage) Invoker {
+	return &local{
+		storage: s,
+	}
+}
 
-	for day := startDay; day <= endDay; day++ {
-		for hour := 0; hour < 24; hour++ {
-			url := fmt.Sprintf("%s/%d-%02d-%02d-%d.json.gz", "https://data.gharchive.org", year, month, day, hour)
-			log.Printf("gh archive url: %s", url)
-
-			wg.Add(1)
-			go func(year, month, day, hour int, url string) {
-				defer wg.Done()
-				payloadRequest := Request{
-					Source: "comana.backfill",
-					Year:   year,
-					Month:  month,
-					Day:    day,
-					Hour:   hour,
-				}
+// archiveURL returns the GH Archive file URL for the hour
+func archiveURL(t time.Time) string {
+	return fmt.Sprintf("https://data.gharchive.org/%d-%02d-%02d-%d.json.gz", t.Year(), int(t.Month()), t.Day(), t.Hour())
+}
 
-				payload, err := json.Marshal(payloadRequest)
-				if err != nil {
-					errs <- fmt.Errorf("payload marshalling error for %s: %s", url, err.Error())
-				}
+// invokeHour triggers the save of a single archive hour, returning the
+// hour status; Lambda function errors are reported through the response
+// payload while asynchronous and queued saves are accepted with a 202
+// status code and remain queued until their report is confirmed
+func invokeHour(client Invoker, t time.Time) (string, error) {
+	url := archiveURL(t)
+	log.Printf("gh archive url: %s", url)
 
-				code, resp, err := client.Invoke(payload)
-				if err != nil {
-					errs <- fmt.Errorf("lambda invocation error for %s: %s", url, err.Error())
-				}
+	payload, err := json.Marshal(Request{
+		Source: "comana.backfill",
+		Year:   t.Year(),
+		Month:  int(t.Month()),
+		Day:    t.Day(),
+		Hour:   t.Hour(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("payload marshalling error for %s: %s", url, err.Error())
+	}
+
+	code, resp, err := client.Invoke(payload)
+	if err != nil {
+		return "", fmt.Errorf("lambda invocation error for %s: %s", url, err.Error())
+	}
+
+	log.Printf("save lambda status code: %d, response: %s", code, resp)
+	if message := gjson.Get(resp, "errorMessage"); code != 200 && code != 202 || message.Exists() {
+		return "", fmt.Errorf("save lambda error for %s: status code %d, response: %s", url, code, resp)
+	}
+
+	if code == 202 {
+		return storage.Queued, nil
+	}
+
+	return storage.Done, nil
+}
+
+// archiveStart is the first hour available from GH Archive
+var archiveStart = time.Date(2011, 2, 12, 0, 0, 0, 0, time.UTC)
+
+// parseHour parses a backfill range bound; a date-only end bound covers
+// the whole day
+func parseHour(value string, end bool) (time.Time, error) {
+	t, err := parseTime(value)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if end && len(value) == len("2006-01-02") {
+		t = t.Add(23 * time.Hour)
+	}
+
+	return t.Truncate(time.Hour), nil
+}
 
-				log.Printf("save lambda status code: %d, response: %s", code, resp)
-			}(int(year), int(month), int(day), hour, url)
+// backfillHours returns every hour of the requested range, given either as
+// the body "from" and "to" timestamps, inclusive, or as the "year",
+// "month", "start_day", and "end_day" of a single month; hours before GH
+// Archive begins or which have not finished by now are rejected
+func backfillHours(body string, now time.Time) ([]time.Time, error) {
+	var from, to time.Time
+
+	if gjson.Get(body, "from").Exists() || gjson.Get(body, "to").Exists() {
+		var err error
+		if from, err = parseHour(gjson.Get(body, "from").String(), false); err != nil {
+			return nil, errors.New("invalid from: " + err.Error())
+		}
+
+		if to, err = parseHour(gjson.Get(body, "to").String(), true); err != nil {
+			return nil, errors.New("invalid to: " + err.Error())
+		}
+	} else {
+		year := int(gjson.Get(body, "year").Int())
+		month := int(gjson.Get(body, "month").Int())
+		startDay := int(gjson.Get(body, "start_day").Int())
+		endDay := int(gjson.Get(body, "end_day").Int())
+
+		days := time.Date(year, time.Month(month)+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		if month < 1 || month > 12 || startDay < 1 || endDay > days {
+			return nil, fmt.Errorf("invalid day range: %d-%02d days %d to %d", year, month, startDay, endDay)
 		}
+
+		from = time.Date(year, time.Month(month), startDay, 0, 0, 0, 0, time.UTC)
+		to = time.Date(year, time.Month(month), endDay, 23, 0, 0, 0, time.UTC)
 	}
 
-	go func() {
-		wg.Wait()
-		close(errs)
-	}()
+	if to.Before(from) {
+		return nil, errors.New("to must not be before from")
+	}
 
-	select {
-	case <-finished:
-	// NOTE: possibly expand to collect all goroutine errors
-	case err := <-errs:
+	if from.Before(archiveStart) {
+		return nil, fmt.Errorf("from must not be before %s when gh archive begins", archiveStart.Format("2006-01-02T15"))
+	}
+
+	if latest := now.UTC().Truncate(time.Hour).Add(-time.Hour); to.After(latest) {
+		return nil, fmt.Errorf("to must not be after %s, the latest finished hour", latest.Format("2006-01-02T15"))
+	}
+
+	hours := []time.Time{}
+	for t := from; !t.After(to); t = t.Add(time.Hour) {
+		hours = append(hours, t)
+	}
+
+	return hours, nil
+}
+
+// backfillJob retrieves the job whose ID is the body "resume" value, with
+// its queued hours confirmed, or otherwise stores a new job for the
+// requested hours
+func backfillJob(req Request, s storage.Storage) (storage.Job, error) {
+	if id := gjson.Get(req.Body, "resume").String(); id != "" {
+		log.Printf("resuming job: %s", id)
+		job, err := storage.GetJob(s, id)
 		if err != nil {
-			return events.APIGatewayProxyResponse{
-				StatusCode:      500,
-				Body:            "error invoking lambda: " + err.Error(),
-				IsBase64Encoded: false,
-			}, err
+			return storage.Job{}, err
+		}
+
+		confirmed, err := storage.ConfirmQueued(s, &job, defaultReport)
+		if err != nil {
+			return storage.Job{}, err
+		}
+		log.Printf("confirmed queued hours: %d", confirmed)
+
+		return job, nil
+	}
+
+	hours, err := backfillHours(req.Body, time.Now())
+	if err != nil {
+		return storage.Job{}, err
+	}
+	log.Printf("from: %s, to: %s", hours[0].Format("2006-01-02T15"), hours[len(hours)-1].Format("2006-01-02T15"))
+
+	job := storage.NewJob(hours)
+	return job, storage.PutJob(s, &job)
+}
+
+// summary totals the outcomes of the invocations made while running a job
+type summary struct {
+	Hours       int               `json:"hours"`
+	Done        int               `json:"done"`
+	Queued      int               `json:"queued"`
+	Failed      int               `json:"failed"`
+	Invocations int               `json:"invocations"`
+	Throttled   int               `json:"throttled"`
+	Failures    map[string]string `json:"failures,omitempty"`
+}
+
+// maxFailures bounds the failed hours listed in a summary error
+const maxFailures = 5
+
+func (s summary) String() string {
+	hours := []string{}
+	for hour := range s.Failures {
+		hours = append(hours, hour)
+	}
+	sort.Strings(hours)
+
+	failures := []string{}
+	for i, hour := range hours {
+		if i == maxFailures {
+			failures = append(failures, fmt.Sprintf("and %d more", len(hours)-maxFailures))
+			break
+		}
+		failures = append(failures, hour+": "+s.Failures[hour])
+	}
+
+	return fmt.Sprintf("failed for %d of %d hours after %d invocations, %d throttled: %s", s.Failed, s.Hours, s.Invocations, s.Throttled, strings.Join(failures, "; "))
+}
+
+// invokeRetry invokes the save of the hour, waiting on the bucket before
+// each attempt and retrying throttled attempts after a jittered backoff;
+// the hour status is returned with the number of attempts made and of
+// those throttled
+func invokeRetry(client Invoker, t time.Time, l limits, b *bucket) (string, int, int, error) {
+	throttles := 0
+	for attempt := 1; ; attempt++ {
+		sleep(b.reserve(time.Now()))
+
+		status, err := invokeHour(client, t)
+		if err == nil || !throttled(err) {
+			return status, attempt, throttles, err
+		}
+
+		throttles++
+		if attempt >= l.attempts {
+			return status, attempt, throttles, err
 		}
+
+		delay := l.retryDelay(attempt)
+		log.Printf("throttled invocation for %s, retrying in %s", t.Format("2006-01-02T15"), delay)
+		sleep(delay)
+	}
+}
+
+// runJob invokes the save of every unfinished hour of the job through a
+// pool of workers bounded by the limits and stores the job as each hour
+// finishes; the summary is returned as an error when any hour failed
+func runJob(job *storage.Job, client Invoker, s storage.Storage, l limits) (summary, error) {
+	unfinished := job.Unfinished()
+	for _, i := range unfinished {
+		job.Hours[i].Status = storage.Running
+	}
+
+	output := summary{
+		Hours:    len(unfinished),
+		Failures: map[string]string{},
+	}
+
+	if err := storage.PutJob(s, job); err != nil {
+		return output, err
+	}
+
+	b := newBucket(l.rate, l.workers, time.Now())
+	indexes := make(chan int)
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	var putErr error
+
+	for w := 0; w < l.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				t := job.Hours[i].Time
+				status, attempts, throttles, err := invokeRetry(client, t, l, b)
+
+				mutex.Lock()
+				hour := &job.Hours[i]
+				hour.Attempts += attempts
+				hour.Status, hour.Error = status, ""
+				output.Invocations += attempts
+				output.Throttled += throttles
+				switch {
+				case err != nil:
+					hour.Status, hour.Error = storage.Failed, err.Error()
+					output.Failures[t.Format("2006-01-02T15")] = err.Error()
+					output.Failed++
+				case status == storage.Queued:
+					output.Queued++
+				default:
+					output.Done++
+				}
+
+				if err := storage.PutJob(s, job); err != nil {
+					putErr = err
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	for _, i := range unfinished {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	if putErr != nil {
+		return output, fmt.Errorf("error storing job %s: %s", job.ID, putErr.Error())
+	}
+
+	if output.Failed > 0 {
+		return output, fmt.Errorf("backfill job %s %s", job.ID, output)
+	}
+
+	return output, nil
+}
+
+// BackfillData pulls in historic data for stat updates, tracking the status
+// of each hour in a stored job; passing a job ID as the body "resume" value
+// runs only the hours of that job which have not succeeded; the job is
+// returned along with a summary of the invocations made
+func BackfillData(req Request, client Invoker, s storage.Storage) (events.APIGatewayProxyResponse, error) {
+	log.Printf("backfill request: %s", req.Body)
+
+	if err := CheckSecret(req); err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            err.Error(),
+			IsBase64Encoded: false,
+		}, err
+	}
+
+	l, err := backfillLimits(req.Body)
+	if err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "error reading backfill limits: " + err.Error(),
+			IsBase64Encoded: false,
+		}, err
+	}
+
+	job, err := backfillJob(req, s)
+	if err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "error creating backfill job: " + err.Error(),
+			IsBase64Encoded: false,
+		}, err
+	}
+	log.Printf("job: %s, hours: %d, unfinished: %d, workers: %d, rate: %g", job.ID, len(job.Hours), len(job.Unfinished()), l.workers, l.rate)
+
+	result, err := runJob(&job, client, s, l)
+	if err != nil {
+		log.Println("error running backfill job: " + err.Error())
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "error running backfill job: " + err.Error(),
+			IsBase64Encoded: false,
+		}, err
+	}
+
+	output, err := json.Marshal(struct {
+		storage.Job
+		Summary summary `json:"summary"`
+	}{
+		Job:     job,
+		Summary: result,
+	})
+	if err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "error marshalling output: " + err.Error(),
+			IsBase64Encoded: false,
+		}, err
 	}
 
 	log.Println("successful backfill")
 	return events.APIGatewayProxyResponse{
 		StatusCode:      200,
-		Body:            "success",
+		Body:            string(output),
+		IsBase64Encoded: false,
+	}, nil
+}
+
+// JobData returns the stored backfill job with the id parameter; queued
+// hours whose reports have since been stored are confirmed as done and
+// the job is updated
+func JobData(req Request, s storage.Storage) (events.APIGatewayProxyResponse, error) {
+	log.Println("job request")
+
+	job, err := storage.GetJob(s, req.param("id"))
+	if err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "error loading job: " + err.Error(),
+			IsBase64Encoded: false,
+		}, err
+	}
+
+	confirmed, err := storage.ConfirmQueued(s, &job, defaultReport)
+	if err == nil && confirmed > 0 {
+		err = storage.PutJob(s, &job)
+	}
+	if err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "error confirming queued hours: " + err.Error(),
+			IsBase64Encoded: false,
+		}, err
+	}
+
+	output, err := json.Marshal(job)
+	if err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "error marshalling output: " + err.Error(),
+			IsBase64Encoded: false,
+		}, err
+	}
+
+	log.Println("job successful")
+	return events.APIGatewayProxyResponse{
+		StatusCode:      200,
+		Body:            string(output),
 		IsBase64Encoded: false,
 	}, nil
 }
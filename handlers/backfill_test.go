@@ -1,10 +1,15 @@
 package handlers
 
 import (
+	"encoding/json"
 	"errors"
 	"os"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/forstmeier/comana/storage"
 )
 
 func TestNewInvoke(t *testing.T) {
@@ -14,6 +19,41 @@ func TestNewInvoke(t *testing.T) {
 	}
 }
 
+func TestNewLocalInvoke(t *testing.T) {
+	tests := []struct {
+		desc    string
+		payload []byte
+		status  int64
+		err     string
+	}{
+		{
+			desc:    "invalid payload",
+			payload: []byte("not-json"),
+			status:  500,
+			err:     "invalid character 'o' in literal null (expecting 'u')",
+		},
+		{
+			desc:    "save data error",
+			payload: []byte(`{"source": "not-source"}`),
+			status:  500,
+			err:     "source must be cloudwatch event or backfill",
+		},
+	}
+
+	for _, test := range tests {
+		i := NewLocalInvoke(&mockStorage{})
+
+		status, _, err := i.Invoke(test.payload)
+		if err != nil && err.Error() != test.err {
+			t.Errorf("description: %s, error received: %s, expected: %s", test.desc, err.Error(), test.err)
+		}
+
+		if status != test.status {
+			t.Errorf("description: %s, status received: %d, expected: %d", test.desc, status, test.status)
+		}
+	}
+}
+
 type mockInvoke struct {
 	invokeStatus int64
 	invokeResp   string
@@ -48,17 +88,47 @@ func TestBackfillData(t *testing.T) {
 		{
 			desc:         "invoke method error",
 			secret:       "test-secret",
-			body:         `{"year": 1977, "month": 5, "startDay": 25, "endDay": 25}`,
+			body:         `{"from": "2019-05-25", "to": "2019-05-25"}`,
 			invokeStatus: 500,
 			invokeResp:   "invoke-error",
 			invokeErr:    errors.New("invoke-error"),
 			status:       500,
-			err:          "lambda invocation error for https://data.gharchive.org/1977-05-00",
+			err:          "lambda invocation error for https://data.gharchive.org/2019-05-25",
+		},
+		{
+			desc:         "save lambda function error",
+			secret:       "test-secret",
+			body:         `{"from": "2019-05-25", "to": "2019-05-25"}`,
+			invokeStatus: 200,
+			invokeResp:   `{"errorMessage": "source must be cloudwatch event or backfill"}`,
+			invokeErr:    nil,
+			status:       500,
+			err:          "failed for 24 of 24 hours",
+		},
+		{
+			desc:         "invalid day range",
+			secret:       "test-secret",
+			body:         `{"year": 2019, "month": 2, "start_day": 1, "end_day": 31}`,
+			invokeStatus: 200,
+			invokeResp:   "invoke-success",
+			invokeErr:    nil,
+			status:       500,
+			err:          "invalid day range: 2019-02 days 1 to 31",
+		},
+		{
+			desc:         "unknown resumed job",
+			secret:       "test-secret",
+			body:         `{"resume": "00000000-0000-0000-0000-000000000001"}`,
+			invokeStatus: 200,
+			invokeResp:   "invoke-success",
+			invokeErr:    nil,
+			status:       500,
+			err:          "job not found",
 		},
 		{
 			desc:         "successful invocation",
 			secret:       "test-secret",
-			body:         `{"year": 1977, "month": 5, "startDay": 25, "endDay": 25}`,
+			body:         `{"from": "2019-05-25", "to": "2019-05-25"}`,
 			invokeStatus: 200,
 			invokeResp:   "invoke-success",
 			invokeErr:    nil,
@@ -83,7 +153,7 @@ func TestBackfillData(t *testing.T) {
 			Body: test.body,
 		}
 
-		resp, err := BackfillData(r, i)
+		resp, err := BackfillData(r, i, storage.NewMemory(""))
 
 		if err != nil && !strings.Contains(err.Error(), test.err) {
 			t.Errorf("description: %s, error received: %s, expected: %s", test.desc, err.Error(), test.err)
@@ -94,3 +164,280 @@ func TestBackfillData(t *testing.T) {
 		}
 	}
 }
+
+func Test_backfillHours(t *testing.T) {
+	now := time.Date(2019, 1, 1, 12, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		desc  string
+		body  string
+		first string
+		last  string
+		count int
+		err   string
+	}{
+		{
+			desc: "invalid from timestamp",
+			body: `{"from": "yesterday", "to": "2018-12-31"}`,
+			err:  "invalid from: invalid timestamp: yesterday",
+		},
+		{
+			desc: "invalid to timestamp",
+			body: `{"from": "2018-12-31"}`,
+			err:  "invalid to: invalid timestamp: ",
+		},
+		{
+			desc: "reversed range",
+			body: `{"from": "2018-12-31T05", "to": "2018-12-31T04"}`,
+			err:  "to must not be before from",
+		},
+		{
+			desc: "range before gh archive",
+			body: `{"from": "2011-02-11T23", "to": "2011-02-12T01"}`,
+			err:  "from must not be before 2011-02-12T00 when gh archive begins",
+		},
+		{
+			desc: "unfinished hour",
+			body: `{"from": "2019-01-01T00", "to": "2019-01-01T12"}`,
+			err:  "to must not be after 2019-01-01T11, the latest finished hour",
+		},
+		{
+			desc: "invalid day range",
+			body: `{"year": 2018, "month": 2, "start_day": 28, "end_day": 31}`,
+			err:  "invalid day range: 2018-02 days 28 to 31",
+		},
+		{
+			desc:  "hours across years",
+			body:  `{"from": "2018-12-31T22:15:00Z", "to": "2019-01-01T01"}`,
+			first: "2018-12-31T22",
+			last:  "2019-01-01T01",
+			count: 4,
+		},
+		{
+			desc:  "whole days",
+			body:  `{"from": "2018-02-28", "to": "2018-03-01"}`,
+			first: "2018-02-28T00",
+			last:  "2018-03-01T23",
+			count: 48,
+		},
+		{
+			desc:  "latest finished hour",
+			body:  `{"from": "2019-01-01T11", "to": "2019-01-01T11"}`,
+			first: "2019-01-01T11",
+			last:  "2019-01-01T11",
+			count: 1,
+		},
+		{
+			desc:  "single month day range",
+			body:  `{"year": 2016, "month": 2, "start_day": 29, "end_day": 29}`,
+			first: "2016-02-29T00",
+			last:  "2016-02-29T23",
+			count: 24,
+		},
+	}
+
+	for _, test := range tests {
+		hours, err := backfillHours(test.body, now)
+		if err != nil {
+			if err.Error() != test.err {
+				t.Errorf("description: %s, error received: %s, expected: %s", test.desc, err.Error(), test.err)
+			}
+			continue
+		}
+
+		if test.err != "" {
+			t.Errorf("description: %s, error received: nil, expected: %s", test.desc, test.err)
+			continue
+		}
+
+		first, last := hours[0].Format("2006-01-02T15"), hours[len(hours)-1].Format("2006-01-02T15")
+		if len(hours) != test.count || first != test.first || last != test.last {
+			t.Errorf("description: %s, hours received: %d from %s to %s, expected: %d from %s to %s", test.desc, len(hours), first, last, test.count, test.first, test.last)
+		}
+	}
+}
+
+type flakyInvoke struct {
+	mutex sync.Mutex
+	calls map[int]int
+}
+
+// Invoke fails the first call for every even hour
+func (f *flakyInvoke) Invoke(payload []byte) (int64, string, error) {
+	req := Request{}
+	json.Unmarshal(payload, &req)
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.calls[req.Hour]++
+	if req.Hour%2 == 0 && f.calls[req.Hour] == 1 {
+		return 500, "", errors.New("function error")
+	}
+	return 200, "success", nil
+}
+
+func TestBackfillDataResume(t *testing.T) {
+	os.Setenv("COMANA_SECRET", "test-secret")
+	s := storage.NewMemory("")
+	i := &flakyInvoke{
+		calls: map[int]int{},
+	}
+
+	req := Request{
+		Headers: map[string]string{
+			"COMANA_SECRET": "test-secret",
+		},
+		Body: `{"from": "2019-05-25", "to": "2019-05-25"}`,
+	}
+
+	if _, err := BackfillData(req, i, s); err == nil || !strings.Contains(err.Error(), "failed for 12 of 24 hours") {
+		t.Fatalf("description: partial failure, error received: %v", err)
+	}
+
+	keys, _ := s.ListKeys("jobs/")
+	if len(keys) != 1 {
+		t.Fatalf("description: stored job, keys received: %v", keys)
+	}
+	id := strings.TrimSuffix(strings.TrimPrefix(keys[0], "jobs/"), ".json")
+
+	resp, err := JobData(Request{QueryStringParameters: map[string]string{"id": id}}, s)
+	if err != nil {
+		t.Fatalf("description: job status, error received: %s", err.Error())
+	}
+
+	job := storage.Job{}
+	json.Unmarshal([]byte(resp.Body), &job)
+	if job.Status != storage.Failed || job.Counts[storage.Done] != 12 || job.Counts[storage.Failed] != 12 {
+		t.Errorf("description: job status, output received: %+v", job)
+	}
+
+	req.Body = `{"resume": "` + id + `"}`
+	resp, err = BackfillData(req, i, s)
+	if err != nil {
+		t.Fatalf("description: resume job, error received: %s", err.Error())
+	}
+
+	json.Unmarshal([]byte(resp.Body), &job)
+	if job.Status != storage.Done || job.Hours[0].Attempts != 2 || job.Hours[1].Attempts != 1 {
+		t.Errorf("description: resume job, output received: %+v", job)
+	}
+
+	for hour, calls := range i.calls {
+		if expected := 1 + (1 - hour%2); calls != expected {
+			t.Errorf("description: resume job, calls received for hour %d: %d, expected: %d", hour, calls, expected)
+		}
+	}
+}
+
+type throttledInvoke struct {
+	mutex     sync.Mutex
+	throttles int
+	calls     map[int]int
+	active    int
+	maxActive int
+}
+
+// Invoke responds as throttled to the first throttles calls for every hour
+func (th *throttledInvoke) Invoke(payload []byte) (int64, string, error) {
+	req := Request{}
+	json.Unmarshal(payload, &req)
+
+	th.mutex.Lock()
+	th.calls[req.Hour]++
+	calls := th.calls[req.Hour]
+	th.active++
+	if th.active > th.maxActive {
+		th.maxActive = th.active
+	}
+	th.mutex.Unlock()
+
+	time.Sleep(time.Millisecond)
+
+	th.mutex.Lock()
+	th.active--
+	th.mutex.Unlock()
+
+	if calls <= th.throttles {
+		return 429, `{"message": "Rate Exceeded."}`, nil
+	}
+	return 200, "success", nil
+}
+
+func TestBackfillDataThrottled(t *testing.T) {
+	os.Setenv("COMANA_SECRET", "test-secret")
+
+	tests := []struct {
+		desc        string
+		throttles   int
+		status      int
+		done        int
+		invocations int
+		throttled   int
+		err         string
+	}{
+		{
+			desc:        "throttled invocations retried",
+			throttles:   2,
+			status:      200,
+			done:        24,
+			invocations: 72,
+			throttled:   48,
+			err:         "",
+		},
+		{
+			desc:        "throttled invocations exhausted",
+			throttles:   5,
+			status:      500,
+			done:        0,
+			invocations: 120,
+			throttled:   120,
+			err:         "failed for 24 of 24 hours after 120 invocations, 120 throttled: 2019-05-25T00: save lambda error",
+		},
+	}
+
+	for _, test := range tests {
+		i := &throttledInvoke{
+			throttles: test.throttles,
+			calls:     map[int]int{},
+		}
+
+		req := Request{
+			Headers: map[string]string{
+				"COMANA_SECRET": "test-secret",
+			},
+			Body: `{"from": "2019-05-25", "to": "2019-05-25", "workers": 3, "rate": 0}`,
+		}
+
+		resp, err := BackfillData(req, i, storage.NewMemory(""))
+		if err != nil && !strings.Contains(err.Error(), test.err) || err == nil && test.err != "" {
+			t.Errorf("description: %s, error received: %v, expected: %s", test.desc, err, test.err)
+		}
+
+		if resp.StatusCode != test.status {
+			t.Errorf("description: %s, status received: %d, expected: %d", test.desc, resp.StatusCode, test.status)
+		}
+
+		if i.maxActive > 3 {
+			t.Errorf("description: %s, concurrent invocations received: %d, expected at most: 3", test.desc, i.maxActive)
+		}
+
+		if test.status != 200 {
+			continue
+		}
+
+		output := struct {
+			storage.Job
+			Summary summary `json:"summary"`
+		}{}
+		json.Unmarshal([]byte(resp.Body), &output)
+
+		if output.Summary.Done != test.done || output.Summary.Invocations != test.invocations || output.Summary.Throttled != test.throttled {
+			t.Errorf("description: %s, summary received: %+v", test.desc, output.Summary)
+		}
+
+		if output.Job.Hours[0].Attempts != 3 {
+			t.Errorf("description: %s, attempts received: %d, expected: 3", test.desc, output.Job.Hours[0].Attempts)
+		}
+	}
+}
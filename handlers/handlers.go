@@ -1,13 +1,94 @@
 package handlers
 
-// Request provides a generalization of CloudWatch and API Gateway events
+import (
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Request provides a generalization of CloudWatch, API Gateway, and SQS events
 type Request struct {
-	Body       string            `json:"body"`
-	HTTPMethod string            `json:"httpMethod"`
-	Headers    map[string]string `json:"headers"`
-	Source     string            `json:"source"`
-	Year       int               `json:"year"`
-	Month      int               `json:"month"`
-	Day        int               `json:"day"`
-	Hour       int               `json:"hour"`
+	Body                            string              `json:"body"`
+	HTTPMethod                      string              `json:"httpMethod"`
+	Headers                         map[string]string   `json:"headers"`
+	QueryStringParameters           map[string]string   `json:"queryStringParameters"`
+	MultiValueQueryStringParameters map[string][]string `json:"multiValueQueryStringParameters"`
+	Source                          string              `json:"source"`
+	Year                            int                 `json:"year"`
+	Month                           int                 `json:"month"`
+	Day                             int                 `json:"day"`
+	Hour                            int                 `json:"hour"`
+	Records                         []events.SQSMessage `json:"Records"`
+}
+
+// header returns the value of a request header regardless of the key's
+// case, which differs between API Gateway and net/http
+func (r Request) header(key string) string {
+	if value, ok := r.Headers[key]; ok {
+		return value
+	}
+
+	for k, value := range r.Headers {
+		if strings.EqualFold(k, key) {
+			return value
+		}
+	}
+	return ""
+}
+
+// params returns all values for a query string parameter, including
+// comma-separated values
+func (r Request) params(key string) []string {
+	values := r.MultiValueQueryStringParameters[key]
+	if len(values) == 0 && r.QueryStringParameters[key] != "" {
+		values = []string{r.QueryStringParameters[key]}
+	}
+
+	output := []string{}
+	for _, value := range values {
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				output = append(output, v)
+			}
+		}
+	}
+
+	return output
+}
+
+// param returns the first value for a query string parameter
+func (r Request) param(key string) string {
+	values := r.params(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// CheckSecret verifies the request carries the configured COMANA_SECRET
+// header required for operations which start jobs or modify stored data
+func CheckSecret(req Request) error {
+	if secret := req.header("COMANA_SECRET"); secret != os.Getenv("COMANA_SECRET") {
+		return errors.New("incorrect secret received: " + secret)
+	}
+	return nil
+}
+
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15",
+	"2006-01-02",
+}
+
+// parseTime parses RFC 3339, hour-granular, or date-only timestamps
+func parseTime(value string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, errors.New("invalid timestamp: " + value)
 }
@@ -5,20 +5,34 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"reflect"
 	"testing"
+	"time"
+
+	"github.com/forstmeier/comana/storage"
 )
 
 func TestMain(m *testing.M) {
 	log.SetOutput(ioutil.Discard)
+	sleep = func(time.Duration) {}
 	os.Exit(m.Run())
 }
 
 type mockStorage struct {
-	putFileErr  error
-	getFilesOut map[string]io.Reader
-	getFilesErr error
-	getPathsOut []string
-	getPathsErr error
+	putFileErr    error
+	getFilesOut   map[string]io.Reader
+	getFilesErr   error
+	getPathsOut   []string
+	getPathsErr   error
+	getReportsOut []storage.Report
+	getReportsErr error
+	putRollupErr  error
+	listKeysOut   []string
+	listKeysErr   error
+	getObjectOut  io.Reader
+	getObjectErr  error
+	putObjectErr  error
+	deleteErr     error
 }
 
 func (m *mockStorage) PutFile(int, int, int, int, string, io.Reader) error {
@@ -28,3 +42,152 @@ func (m *mockStorage) PutFile(int, int, int, int, string, io.Reader) error {
 func (m *mockStorage) GetPaths() ([]string, error) {
 	return m.getPathsOut, m.getPathsErr
 }
+
+func (m *mockStorage) GetReports(storage.Query) ([]storage.Report, error) {
+	return m.getReportsOut, m.getReportsErr
+}
+
+func (m *mockStorage) PutRollup(string, time.Time, string, io.Reader) error {
+	return m.putRollupErr
+}
+
+func (m *mockStorage) ListKeys(string) ([]string, error) {
+	return m.listKeysOut, m.listKeysErr
+}
+
+func (m *mockStorage) GetObject(string) (io.Reader, error) {
+	return m.getObjectOut, m.getObjectErr
+}
+
+func (m *mockStorage) PutObject(string, io.Reader) error {
+	return m.putObjectErr
+}
+
+func (m *mockStorage) DeleteObject(string) error {
+	return m.deleteErr
+}
+
+func Test_header(t *testing.T) {
+	tests := []struct {
+		desc    string
+		headers map[string]string
+		output  string
+	}{
+		{
+			desc:    "missing header",
+			headers: map[string]string{},
+			output:  "",
+		},
+		{
+			desc: "exact header",
+			headers: map[string]string{
+				"COMANA_SECRET": "test-secret",
+			},
+			output: "test-secret",
+		},
+		{
+			desc: "canonicalized header",
+			headers: map[string]string{
+				"Comana_secret": "test-secret",
+			},
+			output: "test-secret",
+		},
+	}
+
+	for _, test := range tests {
+		req := Request{
+			Headers: test.headers,
+		}
+
+		if output := req.header("COMANA_SECRET"); output != test.output {
+			t.Errorf("description: %s, output received: %s, expected: %s", test.desc, output, test.output)
+		}
+	}
+}
+
+func Test_params(t *testing.T) {
+	tests := []struct {
+		desc   string
+		req    Request
+		output []string
+	}{
+		{
+			desc:   "no parameters",
+			req:    Request{},
+			output: []string{},
+		},
+		{
+			desc: "single comma-separated parameter",
+			req: Request{
+				QueryStringParameters: map[string]string{
+					"repo": "luke/x-wing, han/falcon",
+				},
+			},
+			output: []string{"luke/x-wing", "han/falcon"},
+		},
+		{
+			desc: "multi-value parameter",
+			req: Request{
+				QueryStringParameters: map[string]string{
+					"repo": "han/falcon",
+				},
+				MultiValueQueryStringParameters: map[string][]string{
+					"repo": {"luke/x-wing", "han/falcon"},
+				},
+			},
+			output: []string{"luke/x-wing", "han/falcon"},
+		},
+	}
+
+	for _, test := range tests {
+		output := test.req.params("repo")
+		if !reflect.DeepEqual(output, test.output) {
+			t.Errorf("description: %s, output received: %v, expected: %v", test.desc, output, test.output)
+		}
+	}
+}
+
+func Test_parseTime(t *testing.T) {
+	tests := []struct {
+		desc  string
+		value string
+		time  time.Time
+		err   string
+	}{
+		{
+			desc:  "invalid timestamp",
+			value: "may the fourth",
+			time:  time.Time{},
+			err:   "invalid timestamp: may the fourth",
+		},
+		{
+			desc:  "rfc 3339 timestamp",
+			value: "1977-05-25T20:00:00Z",
+			time:  time.Date(1977, 5, 25, 20, 0, 0, 0, time.UTC),
+			err:   "",
+		},
+		{
+			desc:  "hour timestamp",
+			value: "1977-05-25T20",
+			time:  time.Date(1977, 5, 25, 20, 0, 0, 0, time.UTC),
+			err:   "",
+		},
+		{
+			desc:  "date timestamp",
+			value: "1977-05-25",
+			time:  time.Date(1977, 5, 25, 0, 0, 0, 0, time.UTC),
+			err:   "",
+		},
+	}
+
+	for _, test := range tests {
+		output, err := parseTime(test.value)
+		if err != nil && err.Error() != test.err {
+			t.Errorf("description: %s, error received: %s, expected: %s", test.desc, err.Error(), test.err)
+		}
+
+		if !output.Equal(test.time) {
+			t.Errorf("description: %s, time received: %s, expected: %s", test.desc, output, test.time)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/forstmeier/comana/alert"
+	"github.com/forstmeier/comana/storage"
+	"github.com/forstmeier/comana/watchlist"
+)
+
+// alertBaseline is the number of hours preceding a saved hour which its
+// counts are compared against
+const alertBaseline = 7 * 24
+
+// SaveHook runs after SaveData stores the reports of the hour at t
+type SaveHook func(s storage.Storage, t time.Time) error
+
+// saveHooks holds the hooks run after each save keyed by name
+var saveHooks = map[string]SaveHook{}
+
+// RegisterSaveHook adds a hook run after each successful save, replacing
+// any hook previously registered under the name
+func RegisterSaveHook(name string, hook SaveHook) {
+	saveHooks[name] = hook
+}
+
+// runSaveHooks runs every registered hook in name order; failures are
+// logged rather than returned since the hour has already been saved
+func runSaveHooks(s storage.Storage, t time.Time) {
+	names := []string{}
+	for name := range saveHooks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := saveHooks[name](s, t); err != nil {
+			log.Printf("error running %s save hook: %s", name, err.Error())
+		}
+	}
+}
+
+// errNoAlertRepos is returned by alert hooks without repositories since
+// comparing every repository would read a week of unfiltered reports
+var errNoAlertRepos = errors.New("alert repositories are required")
+
+// AlertHook generates a save hook comparing the saved hour's event counts
+// for the repositories against the stored reports of the preceding week
+// and sending any alerts to the notifier
+func AlertHook(d alert.Detector, n alert.Notifier, repos []string) SaveHook {
+	return func(s storage.Storage, t time.Time) error {
+		if len(repos) == 0 {
+			return errNoAlertRepos
+		}
+
+		return detect(s, t, d, n, defaultReport, repos)
+	}
+}
+
+// WatchlistAlertHook generates a save hook like AlertHook for the entities
+// of the named watchlist, which is read on each run so that changes apply
+// from the next save; watched owners are compared by their per-owner-count
+// totals so that both queries read only the watched keys
+func WatchlistAlertHook(d alert.Detector, n alert.Notifier, name string) SaveHook {
+	return func(s storage.Storage, t time.Time) error {
+		w, err := watchlist.Get(s, name)
+		if err != nil {
+			return err
+		}
+
+		// repositories and owners are both checked before an error is returned
+		errs := []error{}
+		if len(w.Repos) > 0 {
+			errs = append(errs, detect(s, t, d, n, defaultReport, w.Repos))
+		}
+
+		if len(w.Owners) > 0 {
+			errs = append(errs, detect(s, t, d, n, ownerReport, w.Owners))
+		}
+
+		for _, err := range errs {
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// detect runs the detector over the saved hour and preceding week of the
+// report for its keys, repositories or owners, which are read from the
+// index when the day has been indexed
+func detect(s storage.Storage, t time.Time, d alert.Detector, n alert.Notifier, report string, keys []string) error {
+	reports, err := s.GetReports(storage.Query{
+		Start:  t.Add(-alertBaseline * time.Hour),
+		End:    t,
+		Period: storage.Hour,
+		Report: report,
+		Repos:  keys,
+	})
+	if err != nil {
+		return err
+	}
+
+	current := storage.Counts{}
+	baseline := []storage.Counts{}
+	for _, report := range reports {
+		counts := report.Counts
+		if report.Time.Equal(t) {
+			current.Add(counts)
+		} else {
+			baseline = append(baseline, counts)
+		}
+	}
+
+	alerts := d.Detect(t, current, baseline)
+	if len(alerts) == 0 {
+		return nil
+	}
+
+	log.Printf("sending %d alerts for %s", len(alerts), t.Format("2006-01-02T15"))
+	return n.Notify(alerts)
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/forstmeier/comana/alert"
+	"github.com/forstmeier/comana/storage"
+)
+
+func Test_runSaveHooks(t *testing.T) {
+	defer func(original map[string]SaveHook) {
+		saveHooks = original
+	}(saveHooks)
+	saveHooks = map[string]SaveHook{}
+
+	now := time.Date(1977, 5, 25, 20, 0, 0, 0, time.UTC)
+	ran := []string{}
+	for _, name := range []string{"webhooks", "alerts"} {
+		name := name
+		RegisterSaveHook(name, func(s storage.Storage, hour time.Time) error {
+			if !hour.Equal(now) {
+				return errors.New("unexpected hour: " + hour.String())
+			}
+			ran = append(ran, name)
+			return errors.New("hook error")
+		})
+	}
+
+	runSaveHooks(&mockStorage{}, now)
+
+	if expected := []string{"alerts", "webhooks"}; !reflect.DeepEqual(ran, expected) {
+		t.Errorf("description: hooks run despite errors, output received: %v, expected: %v", ran, expected)
+	}
+}
+
+type notifierMock struct {
+	alerts []alert.Alert
+	err    error
+}
+
+func (n *notifierMock) Notify(alerts []alert.Alert) error {
+	n.alerts = append(n.alerts, alerts...)
+	return n.err
+}
+
+func TestAlertHook(t *testing.T) {
+	now := time.Date(1977, 5, 25, 20, 0, 0, 0, time.UTC)
+	reports := []storage.Report{}
+	for i := 24; i > 0; i-- {
+		reports = append(reports, storage.Report{
+			Time: now.Add(-time.Duration(i) * time.Hour),
+			File: storage.File{
+				Counts: storage.Counts{
+					"luke/x-wing": {"WatchEvent": 2},
+				},
+			},
+		})
+	}
+
+	tests := []struct {
+		desc          string
+		repos         []string
+		current       int
+		getReportsErr error
+		notifyErr     error
+		alerts        int
+		err           string
+	}{
+		{
+			desc:    "no repositories",
+			repos:   nil,
+			current: 90,
+			alerts:  0,
+			err:     "alert repositories are required",
+		},
+		{
+			desc:          "get reports error",
+			repos:         []string{"luke/x-wing"},
+			getReportsErr: errors.New("get reports error"),
+			err:           "get reports error",
+		},
+		{
+			desc:    "no alerts",
+			repos:   []string{"luke/x-wing"},
+			current: 3,
+			alerts:  0,
+		},
+		{
+			desc:      "notify error",
+			repos:     []string{"luke/x-wing"},
+			current:   90,
+			notifyErr: errors.New("notify error"),
+			alerts:    1,
+			err:       "notify error",
+		},
+		{
+			desc:    "spike alert",
+			repos:   []string{"luke/x-wing"},
+			current: 90,
+			alerts:  1,
+		},
+	}
+
+	for _, test := range tests {
+		s := &mockStorage{
+			getReportsOut: append(reports, storage.Report{
+				Time: now,
+				File: storage.File{
+					Counts: storage.Counts{
+						"luke/x-wing": {"WatchEvent": test.current},
+					},
+				},
+			}),
+			getReportsErr: test.getReportsErr,
+		}
+		n := &notifierMock{
+			err: test.notifyErr,
+		}
+
+		err := AlertHook(alert.NewDetector(), n, test.repos)(s, now)
+
+		if err != nil && err.Error() != test.err {
+			t.Errorf("description: %s, error received: %s, expected: %s", test.desc, err.Error(), test.err)
+		}
+
+		if err == nil && test.err != "" {
+			t.Errorf("description: %s, error received: nil, expected: %s", test.desc, test.err)
+		}
+
+		if len(n.alerts) != test.alerts {
+			t.Errorf("description: %s, alerts received: %+v, expected count: %d", test.desc, n.alerts, test.alerts)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/forstmeier/comana/storage"
+)
+
+// buildIndex rebuilds the repository index of a report for a day
+var buildIndex = storage.BuildIndex
+
+// IndexData rebuilds the per-repository index of every report for a day
+// so repository queries read one index shard per day rather than each hour
+func IndexData(req Request, s storage.Storage) (events.APIGatewayProxyResponse, error) {
+	log.Printf("index request: %s", req.Body)
+
+	if req.Source != "aws.events" && req.Source != "comana.index" {
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "source must be cloudwatch event or index",
+			IsBase64Encoded: false,
+		}, errors.New("source must be cloudwatch event or index")
+	}
+
+	day := time.Date(req.Year, time.Month(req.Month), req.Day, 0, 0, 0, 0, time.UTC)
+	if req.Source == "aws.events" {
+		day = storage.PeriodStart(storage.Day, time.Now().UTC().AddDate(0, 0, -1))
+	}
+	log.Printf("source: %s, day: %s", req.Source, day.Format("2006-01-02"))
+
+	for _, report := range reportNames() {
+		if err := buildIndex(s, day, report); err != nil {
+			log.Printf("error indexing %s: %s", report, err.Error())
+			return events.APIGatewayProxyResponse{
+				StatusCode:      500,
+				Body:            fmt.Sprintf("error indexing %s: %s", report, err.Error()),
+				IsBase64Encoded: false,
+			}, err
+		}
+	}
+
+	log.Println("successful index")
+	return events.APIGatewayProxyResponse{
+		StatusCode:      200,
+		Body:            "success",
+		IsBase64Encoded: false,
+	}, nil
+}
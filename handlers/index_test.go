@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/forstmeier/comana/storage"
+)
+
+func TestIndexData(t *testing.T) {
+	tests := []struct {
+		desc          string
+		src           string
+		buildIndexErr error
+		status        int
+		err           string
+	}{
+		{
+			desc:          "incorrect source",
+			src:           "not-source",
+			buildIndexErr: nil,
+			status:        500,
+			err:           "source must be cloudwatch event or index",
+		},
+		{
+			desc:          "build index error",
+			src:           "comana.index",
+			buildIndexErr: errors.New("build index error"),
+			status:        500,
+			err:           "build index error",
+		},
+		{
+			desc:          "successful invocation",
+			src:           "comana.index",
+			buildIndexErr: nil,
+			status:        200,
+			err:           "",
+		},
+	}
+
+	defer func(original func(storage.Storage, time.Time, string) error) {
+		buildIndex = original
+	}(buildIndex)
+
+	for _, test := range tests {
+		days := []time.Time{}
+		buildIndex = func(s storage.Storage, day time.Time, report string) error {
+			days = append(days, day)
+			return test.buildIndexErr
+		}
+
+		req := Request{
+			Source: test.src,
+			Year:   1977,
+			Month:  5,
+			Day:    25,
+		}
+
+		resp, err := IndexData(req, &mockStorage{})
+
+		if err != nil && err.Error() != test.err {
+			t.Errorf("description: %s, error received: %s, expected: %s", test.desc, err.Error(), test.err)
+		}
+
+		if resp.StatusCode != test.status {
+			t.Errorf("description: %s, status received: %d, expected: %d", test.desc, resp.StatusCode, test.status)
+		}
+
+		expected := time.Date(1977, 5, 25, 0, 0, 0, 0, time.UTC)
+		if test.status == 200 && (len(days) != len(reportNames()) || !days[0].Equal(expected)) {
+			t.Errorf("description: %s, days received: %v, expected: %s", test.desc, days, expected)
+		}
+	}
+}
+
+func TestSaveDataInvalidatesIndex(t *testing.T) {
+	s := storage.NewMemory("")
+	hour := time.Date(2019, 5, 25, 20, 0, 0, 0, time.UTC)
+
+	// hooks sorted before any index hook must already read the saved counts
+	hooked := 0
+	RegisterSaveHook("alerts", func(s storage.Storage, t time.Time) error {
+		reports, err := s.GetReports(storage.Query{
+			Start:  t,
+			End:    t,
+			Report: defaultReport,
+			Repos:  []string{"luke/x-wing"},
+		})
+		if err == nil && len(reports) == 1 {
+			hooked = reports[0].Counts["luke/x-wing"]["PushEvent"]
+		}
+		return err
+	})
+	defer delete(saveHooks, "alerts")
+
+	dwn, uzp, prs := download, unzip, parse
+	defer func() {
+		download, unzip, parse = dwn, uzp, prs
+	}()
+
+	download = func(string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader("")), nil
+	}
+	unzip = func(io.Reader) (*bufio.Reader, error) {
+		return nil, nil
+	}
+
+	req := Request{Source: "comana.backfill", Year: 2019, Month: 5, Day: 25, Hour: 20}
+	for i, count := range []string{"1", "9"} {
+		parse = func(*bufio.Reader) (map[string]io.Reader, error) {
+			return map[string]io.Reader{
+				defaultReport: strings.NewReader(`{"counts":{"luke/x-wing":{"PushEvent":` + count + `}}}`),
+			}, nil
+		}
+
+		if _, err := SaveData(req, s); err != nil {
+			t.Fatalf("description: save %d, error received: %s", i, err.Error())
+		}
+
+		if i == 0 {
+			if err := storage.BuildIndex(s, hour, defaultReport); err != nil {
+				t.Fatalf("description: build index, error received: %s", err.Error())
+			}
+		}
+	}
+
+	reports, err := s.GetReports(storage.Query{
+		Start:  hour,
+		End:    hour,
+		Report: defaultReport,
+		Repos:  []string{"luke/x-wing"},
+	})
+	if err != nil || len(reports) != 1 || reports[0].Counts["luke/x-wing"]["PushEvent"] != 9 {
+		t.Errorf("description: saved again after indexing, output received: %+v %v", reports, err)
+	}
+
+	if hooked != 9 {
+		t.Errorf("description: save hook after indexing, count received: %d, expected: 9", hooked)
+	}
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// sleep pauses between rate limited and retried invocations
+var sleep = time.Sleep
+
+// limits bounds the backfill invocations: at most workers run at once,
+// they start at most rate times per second, and throttled invocations
+// are attempted up to attempts times with backoff doubling between them
+type limits struct {
+	workers  int
+	rate     float64
+	attempts int
+	backoff  time.Duration
+}
+
+// backfillLimits returns the default limits overridden by the
+// COMANA_BACKFILL_WORKERS and COMANA_BACKFILL_RATE environment variables
+// and then by the body "workers" and "rate" values; a rate of zero
+// disables rate limiting
+func backfillLimits(body string) (limits, error) {
+	l := limits{
+		workers:  8,
+		rate:     4,
+		attempts: 5,
+		backoff:  time.Second,
+	}
+
+	for _, value := range []string{os.Getenv("COMANA_BACKFILL_WORKERS"), gjson.Get(body, "workers").String()} {
+		if value == "" {
+			continue
+		}
+
+		workers, err := strconv.Atoi(value)
+		if err != nil || workers < 1 {
+			return limits{}, fmt.Errorf("invalid workers: %s", value)
+		}
+		l.workers = workers
+	}
+
+	for _, value := range []string{os.Getenv("COMANA_BACKFILL_RATE"), gjson.Get(body, "rate").String()} {
+		if value == "" {
+			continue
+		}
+
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate < 0 {
+			return limits{}, fmt.Errorf("invalid rate: %s", value)
+		}
+		l.rate = rate
+	}
+
+	return l, nil
+}
+
+// retryDelay returns the exponential backoff before the retry following
+// the attempt, randomly jittered between half and all of the delay
+func (l limits) retryDelay(attempt int) time.Duration {
+	delay := l.backoff << uint(attempt-1)
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// bucket is a token bucket holding up to burst tokens and refilled at
+// rate tokens per second
+type bucket struct {
+	mutex  sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate float64, burst int, now time.Time) *bucket {
+	return &bucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+// reserve takes a token and returns how long to wait before it may be
+// used; waiting callers hold a debt against the bucket so that later
+// callers wait behind them
+func (b *bucket) reserve(now time.Time) time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if now.After(b.last) {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+	}
+
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// throttleMarkers identify Lambda concurrency and GH Archive rate limit
+// errors in invocation errors and responses
+var throttleMarkers = []string{
+	"throttl",
+	"toomanyrequests",
+	"too many requests",
+	"rate exceeded",
+	"status code 429",
+}
+
+// throttled reports whether the invocation error was caused by throttling
+// and is worth retrying
+func throttled(err error) bool {
+	message := strings.ToLower(err.Error())
+	for _, marker := range throttleMarkers {
+		if strings.Contains(message, marker) {
+			return true
+		}
+	}
+	return false
+}
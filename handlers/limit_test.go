@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func Test_backfillLimits(t *testing.T) {
+	tests := []struct {
+		desc    string
+		workers string
+		rate    string
+		body    string
+		output  limits
+		err     string
+	}{
+		{
+			desc:   "default limits",
+			body:   "",
+			output: limits{workers: 8, rate: 4, attempts: 5, backoff: time.Second},
+			err:    "",
+		},
+		{
+			desc:    "environment limits",
+			workers: "2",
+			rate:    "0.5",
+			body:    "",
+			output:  limits{workers: 2, rate: 0.5, attempts: 5, backoff: time.Second},
+			err:     "",
+		},
+		{
+			desc:    "body overrides environment",
+			workers: "2",
+			rate:    "0.5",
+			body:    `{"workers": 16, "rate": 0}`,
+			output:  limits{workers: 16, rate: 0, attempts: 5, backoff: time.Second},
+			err:     "",
+		},
+		{
+			desc:    "invalid environment workers",
+			workers: "many",
+			body:    "",
+			err:     "invalid workers: many",
+		},
+		{
+			desc: "invalid body workers",
+			body: `{"workers": 0}`,
+			err:  "invalid workers: 0",
+		},
+		{
+			desc: "invalid body rate",
+			body: `{"rate": -1}`,
+			err:  "invalid rate: -1",
+		},
+	}
+
+	defer os.Unsetenv("COMANA_BACKFILL_WORKERS")
+	defer os.Unsetenv("COMANA_BACKFILL_RATE")
+
+	for _, test := range tests {
+		os.Setenv("COMANA_BACKFILL_WORKERS", test.workers)
+		os.Setenv("COMANA_BACKFILL_RATE", test.rate)
+
+		output, err := backfillLimits(test.body)
+		if err != nil {
+			if err.Error() != test.err {
+				t.Errorf("description: %s, error received: %s, expected: %s", test.desc, err.Error(), test.err)
+			}
+			continue
+		}
+
+		if output != test.output {
+			t.Errorf("description: %s, output received: %+v, expected: %+v", test.desc, output, test.output)
+		}
+	}
+}
+
+func Test_retryDelay(t *testing.T) {
+	l := limits{backoff: time.Second}
+
+	for attempt, max := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 4: 8 * time.Second} {
+		for i := 0; i < 100; i++ {
+			if delay := l.retryDelay(attempt); delay < max/2 || delay > max {
+				t.Errorf("description: attempt %d, delay received: %s, expected between: %s and %s", attempt, delay, max/2, max)
+			}
+		}
+	}
+}
+
+func Test_bucket(t *testing.T) {
+	now := time.Date(2019, 5, 25, 0, 0, 0, 0, time.UTC)
+	b := newBucket(2, 2, now)
+
+	expected := []time.Duration{0, 0, 500 * time.Millisecond, time.Second}
+	for i, delay := range expected {
+		if output := b.reserve(now); output != delay {
+			t.Errorf("description: reservation %d, delay received: %s, expected: %s", i, output, delay)
+		}
+	}
+
+	if output := b.reserve(now.Add(2 * time.Second)); output != 0 {
+		t.Errorf("description: refilled bucket, delay received: %s, expected: 0s", output)
+	}
+
+	if output := newBucket(0, 1, now).reserve(now); output != 0 {
+		t.Errorf("description: unlimited bucket, delay received: %s, expected: 0s", output)
+	}
+}
+
+func Test_throttled(t *testing.T) {
+	tests := []struct {
+		err    error
+		output bool
+	}{
+		{errors.New("lambda invocation error for url: TooManyRequestsException: Rate Exceeded."), true},
+		{errors.New("save lambda error for url: status code 429, response: "), true},
+		{errors.New("save lambda error for url: status code 200, response: {\"errorMessage\": \"unexpected status code 429 for url\"}"), true},
+		{errors.New("save lambda error for url: status code 500, response: "), false},
+	}
+
+	for _, test := range tests {
+		if output := throttled(test.err); output != test.output {
+			t.Errorf("description: %s, output received: %t, expected: %t", test.err.Error(), output, test.output)
+		}
+	}
+}
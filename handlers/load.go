@@ -1,19 +1,175 @@
 package handlers
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"log"
 	"strconv"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 
 	"github.com/forstmeier/comana/storage"
 )
 
+// defaultReport is the report type returned when none is requested
+const defaultReport = "per-repo-count"
+
+// defaultLimit is the number of reports returned per page when no limit
+// parameter is provided
+const defaultLimit = 100
+
+// page returns the bounds of the page requested through the limit and
+// cursor parameters within a result set of the provided length, along with
+// the opaque cursor for the following page when one exists
+func page(req Request, length int) (int, int, string, error) {
+	limit := defaultLimit
+	if value := req.param("limit"); value != "" {
+		l, err := strconv.Atoi(value)
+		if err != nil || l < 1 {
+			return 0, 0, "", errors.New("invalid limit: " + value)
+		}
+		limit = l
+	}
+
+	start := 0
+	if value := req.param("cursor"); value != "" {
+		b, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil {
+			return 0, 0, "", errors.New("invalid cursor: " + value)
+		}
+
+		offset, err := strconv.Atoi(string(b))
+		if err != nil || offset < 0 {
+			return 0, 0, "", errors.New("invalid cursor: " + value)
+		}
+		start = offset
+	}
+
+	if start > length {
+		start = length
+	}
+
+	end := start + limit
+	if end >= length {
+		return start, length, "", nil
+	}
+
+	return start, end, base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(end))), nil
+}
+
+// pathsPage wraps a page of report paths along with the next cursor
+type pathsPage struct {
+	Paths []string `json:"paths"`
+	Next  string   `json:"next,omitempty"`
+}
+
+// reportsPage wraps a page of reports along with the next cursor
+type reportsPage struct {
+	Reports []storage.Report `json:"reports"`
+	Next    string           `json:"next,omitempty"`
+}
+
+// parseQuery converts request query string parameters into a storage query;
+// the window defaults to the most recent 24 hours
+func parseQuery(req Request) (storage.Query, error) {
+	end := time.Now().UTC().Truncate(time.Hour)
+	if value := req.param("end"); value != "" {
+		t, err := parseTime(value)
+		if err != nil {
+			return storage.Query{}, err
+		}
+		end = t
+	}
+
+	start := end.Add(-23 * time.Hour)
+	if value := req.param("start"); value != "" {
+		t, err := parseTime(value)
+		if err != nil {
+			return storage.Query{}, err
+		}
+		start = t
+	}
+
+	period := req.param("period")
+	if period != "" && !storage.ValidPeriod(period) {
+		return storage.Query{}, errors.New("invalid period: " + period)
+	}
+
+	report := req.param("report")
+	if report == "" {
+		report = defaultReport
+	}
+
+	return storage.Query{
+		Start:  start,
+		End:    end,
+		Period: period,
+		Report: report,
+		Repos:  req.params("repo"),
+		Owners: req.params("owner"),
+		Events: req.params("type"),
+	}, nil
+}
+
+// checkFiltered rejects queries without a repo or owner filter, as every
+// repository's counts for even a single period can exceed the size of a
+// response; unfiltered data is served through the presigned report paths
+func checkFiltered(q storage.Query) error {
+	if len(q.Repos) == 0 && len(q.Owners) == 0 {
+		return errors.New("a repo or owner parameter is required for report counts, request /load without query parameters for the report file paths of all repositories")
+	}
+	return nil
+}
+
+// periods returns the beginning of every period within the query window,
+// which reports are paged over before any are retrieved
+func periods(q storage.Query) []time.Time {
+	period := q.Period
+	if period == "" {
+		period = storage.Hour
+	}
+
+	output := []time.Time{}
+	for t := storage.PeriodStart(period, q.Start); !t.After(q.End); t = storage.PeriodNext(period, t) {
+		output = append(output, t)
+	}
+	return output
+}
+
+// isQuery reports whether any report filter parameters were provided
+func isQuery(req Request) bool {
+	for _, key := range []string{"start", "end", "period", "report", "repo", "owner", "type"} {
+		if len(req.params(key)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
 // LoadData retrieves and returns GitHub Archive reports
-func LoadData(s storage.Storage) (events.APIGatewayProxyResponse, error) {
+func LoadData(req Request, s storage.Storage) (events.APIGatewayProxyResponse, error) {
 	log.Println("load request")
 
+	switch mode := req.param("mode"); mode {
+	case "":
+	case "top":
+		return loadTop(req, s)
+	case "stats":
+		return loadStats(req, s)
+	default:
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "invalid mode: " + mode,
+			IsBase64Encoded: false,
+		}, errors.New("invalid mode: " + mode)
+	}
+
+	if isQuery(req) {
+		return loadReports(req, s)
+	}
+
 	paths, err := s.GetPaths()
 	log.Printf("paths count: %d", len(paths))
 	if err != nil {
@@ -24,8 +180,19 @@ func LoadData(s storage.Storage) (events.APIGatewayProxyResponse, error) {
 		}, err
 	}
 
-	pathsObject := map[string][]string{
-		"paths": paths,
+	start, end, next, err := page(req, len(paths))
+	if err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "error parsing page: " + err.Error(),
+			IsBase64Encoded: false,
+		}, err
+	}
+	paths = paths[start:end]
+
+	pathsObject := pathsPage{
+		Paths: paths,
+		Next:  next,
 	}
 
 	output, err := json.Marshal(pathsObject)
@@ -47,3 +214,70 @@ func LoadData(s storage.Storage) (events.APIGatewayProxyResponse, error) {
 		IsBase64Encoded: false,
 	}, err
 }
+
+func loadReports(req Request, s storage.Storage) (events.APIGatewayProxyResponse, error) {
+	q, err := parseQuery(req)
+	if err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "error parsing query: " + err.Error(),
+			IsBase64Encoded: false,
+		}, err
+	}
+	log.Printf("query start: %s, end: %s, period: %s, report: %s, repos: %v, owners: %v, types: %v", q.Start, q.End, q.Period, q.Report, q.Repos, q.Owners, q.Events)
+
+	if err := checkFiltered(q); err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "error parsing query: " + err.Error(),
+			IsBase64Encoded: false,
+		}, err
+	}
+
+	window := periods(q)
+	start, end, next, err := page(req, len(window))
+	if err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "error parsing page: " + err.Error(),
+			IsBase64Encoded: false,
+		}, err
+	}
+
+	reports := []storage.Report{}
+	if start < end {
+		q.Start, q.End = window[start], window[end-1]
+		reports, err = s.GetReports(q)
+		if err != nil {
+			return events.APIGatewayProxyResponse{
+				StatusCode:      500,
+				Body:            "error loading reports: " + err.Error(),
+				IsBase64Encoded: false,
+			}, err
+		}
+	}
+
+	reportsObject := reportsPage{
+		Reports: reports,
+		Next:    next,
+	}
+
+	output, err := json.Marshal(reportsObject)
+	if err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "error marshalling output: " + err.Error(),
+			IsBase64Encoded: false,
+		}, err
+	}
+
+	log.Println("load successful")
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers: map[string]string{
+			"result_count": strconv.Itoa(len(reports)),
+		},
+		Body:            string(output),
+		IsBase64Encoded: false,
+	}, nil
+}
@@ -1,17 +1,25 @@
 package handlers
 
 import (
+	"encoding/json"
 	"errors"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/forstmeier/comana/storage"
 )
 
 func TestLoadData(t *testing.T) {
 	tests := []struct {
-		desc        string
-		getPathsOut []string
-		getPathsErr error
-		status      int
-		err         string
+		desc          string
+		query         map[string]string
+		getPathsOut   []string
+		getPathsErr   error
+		getReportsOut []storage.Report
+		getReportsErr error
+		status        int
+		err           string
 	}{
 		{
 			desc:        "get paths error",
@@ -27,15 +35,109 @@ func TestLoadData(t *testing.T) {
 			status:      200,
 			err:         "",
 		},
+		{
+			desc: "invalid limit parameter",
+			query: map[string]string{
+				"limit": "-1",
+			},
+			getPathsOut: []string{},
+			getPathsErr: nil,
+			status:      500,
+			err:         "invalid limit: -1",
+		},
+		{
+			desc: "invalid query parameter",
+			query: map[string]string{
+				"start": "long ago",
+			},
+			status: 500,
+			err:    "invalid timestamp: long ago",
+		},
+		{
+			desc: "invalid period parameter",
+			query: map[string]string{
+				"period": "decade",
+			},
+			status: 500,
+			err:    "invalid period: decade",
+		},
+		{
+			desc: "unfiltered hourly query",
+			query: map[string]string{
+				"start": "1977-05-25T00",
+			},
+			status: 500,
+			err:    "a repo or owner parameter is required for report counts, request /load without query parameters for the report file paths of all repositories",
+		},
+		{
+			desc: "unfiltered day query",
+			query: map[string]string{
+				"start":  "1977-05-25",
+				"period": "day",
+			},
+			status: 500,
+			err:    "a repo or owner parameter is required for report counts, request /load without query parameters for the report file paths of all repositories",
+		},
+		{
+			desc: "owner filtered day query",
+			query: map[string]string{
+				"start":  "1977-05-25",
+				"period": "day",
+				"owner":  "luke",
+			},
+			getReportsOut: []storage.Report{},
+			status:        200,
+			err:           "",
+		},
+		{
+			desc: "get reports error",
+			query: map[string]string{
+				"repo": "luke/x-wing",
+			},
+			getReportsOut: nil,
+			getReportsErr: errors.New("get reports error"),
+			status:        500,
+			err:           "get reports error",
+		},
+		{
+			desc: "successful query invocation",
+			query: map[string]string{
+				"start": "1977-05-25T00",
+				"end":   "1977-05-25T23",
+				"repo":  "luke/x-wing",
+				"type":  "PushEvent",
+			},
+			getReportsOut: []storage.Report{
+				{
+					Time: time.Date(1977, 5, 25, 20, 0, 0, 0, time.UTC),
+					File: storage.File{
+						Counts: storage.Counts{
+							"luke/x-wing": {
+								"PushEvent": 1,
+							},
+						},
+					},
+				},
+			},
+			getReportsErr: nil,
+			status:        200,
+			err:           "",
+		},
 	}
 
 	for _, test := range tests {
 		s := &mockStorage{
-			getPathsOut: test.getPathsOut,
-			getPathsErr: test.getPathsErr,
+			getPathsOut:   test.getPathsOut,
+			getPathsErr:   test.getPathsErr,
+			getReportsOut: test.getReportsOut,
+			getReportsErr: test.getReportsErr,
 		}
 
-		resp, err := LoadData(s)
+		req := Request{
+			QueryStringParameters: test.query,
+		}
+
+		resp, err := LoadData(req, s)
 
 		if err != nil && err.Error() != test.err {
 			t.Errorf("description: %s, error received: %s, expected: %s", test.desc, err.Error(), test.err)
@@ -46,3 +148,114 @@ func TestLoadData(t *testing.T) {
 		}
 	}
 }
+
+func TestLoadDataPaged(t *testing.T) {
+	s := storage.NewMemory("")
+	for _, hour := range []int{20, 21, 22} {
+		if err := s.PutFile(1977, 5, 25, hour, defaultReport, strings.NewReader(`{"luke/x-wing":{"PushEvent":1}}`)); err != nil {
+			t.Fatalf("description: put file, error received: %s", err.Error())
+		}
+	}
+
+	query := map[string]string{
+		"start": "1977-05-25T00",
+		"end":   "1977-05-25T23",
+		"owner": "luke",
+		"limit": "21",
+	}
+
+	for _, expected := range []int{1, 2} {
+		resp, err := LoadData(Request{QueryStringParameters: query}, s)
+		if err != nil {
+			t.Fatalf("description: paged reports, error received: %s", err.Error())
+		}
+
+		output := reportsPage{}
+		json.Unmarshal([]byte(resp.Body), &output)
+
+		if len(output.Reports) != expected {
+			t.Errorf("description: paged reports, reports received: %d, expected: %d", len(output.Reports), expected)
+		}
+
+		if expected == 1 && output.Next == "" || expected == 2 && output.Next != "" {
+			t.Errorf("description: paged reports, next received: %q", output.Next)
+		}
+		query["cursor"] = output.Next
+	}
+}
+
+func Test_page(t *testing.T) {
+	tests := []struct {
+		desc   string
+		query  map[string]string
+		length int
+		start  int
+		end    int
+		next   string
+		err    string
+	}{
+		{
+			desc:   "default limit",
+			query:  map[string]string{},
+			length: 150,
+			start:  0,
+			end:    100,
+			next:   "MTAw",
+			err:    "",
+		},
+		{
+			desc: "cursor to final page",
+			query: map[string]string{
+				"cursor": "MTAw",
+			},
+			length: 150,
+			start:  100,
+			end:    150,
+			next:   "",
+			err:    "",
+		},
+		{
+			desc: "cursor past result set",
+			query: map[string]string{
+				"cursor": "MTAwMA",
+				"limit":  "10",
+			},
+			length: 5,
+			start:  5,
+			end:    5,
+			next:   "",
+			err:    "",
+		},
+		{
+			desc: "invalid limit",
+			query: map[string]string{
+				"limit": "all",
+			},
+			length: 5,
+			err:    "invalid limit: all",
+		},
+		{
+			desc: "invalid cursor",
+			query: map[string]string{
+				"cursor": "not a cursor",
+			},
+			length: 5,
+			err:    "invalid cursor: not a cursor",
+		},
+	}
+
+	for _, test := range tests {
+		req := Request{
+			QueryStringParameters: test.query,
+		}
+
+		start, end, next, err := page(req, test.length)
+		if err != nil && err.Error() != test.err {
+			t.Errorf("description: %s, error received: %s, expected: %s", test.desc, err.Error(), test.err)
+		}
+
+		if err == nil && (start != test.start || end != test.end || next != test.next) {
+			t.Errorf("description: %s, received: %d %d %s, expected: %d %d %s", test.desc, start, end, next, test.start, test.end, test.next)
+		}
+	}
+}
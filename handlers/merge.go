@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/forstmeier/comana/storage"
+)
+
+// merged is the single document returned by MergeData
+type merged struct {
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Period string    `json:"period"`
+	Report string    `json:"report"`
+	Files  int       `json:"files"`
+	storage.File
+}
+
+// MergeData returns the sum of the matching stored reports over the
+// requested window as a single document; distinct counts such as actors
+// are left out since they cannot be summed
+func MergeData(req Request, s storage.Storage) (events.APIGatewayProxyResponse, error) {
+	log.Println("merge request")
+
+	q, err := parseQuery(req)
+	if err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "error parsing query: " + err.Error(),
+			IsBase64Encoded: false,
+		}, err
+	}
+
+	if q.Period == "" {
+		q.Period = storage.Hour
+	}
+	log.Printf("query start: %s, end: %s, period: %s, report: %s, repos: %v, owners: %v, types: %v", q.Start, q.End, q.Period, q.Report, q.Repos, q.Owners, q.Events)
+
+	if err := checkFiltered(q); err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "error parsing query: " + err.Error(),
+			IsBase64Encoded: false,
+		}, err
+	}
+
+	reports, err := s.GetReports(q)
+	if err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "error loading reports: " + err.Error(),
+			IsBase64Encoded: false,
+		}, err
+	}
+
+	result := merged{
+		Start:  q.Start,
+		End:    q.End,
+		Period: q.Period,
+		Report: q.Report,
+		Files:  len(reports),
+		File: storage.File{
+			Counts: storage.Counts{},
+		},
+	}
+
+	for _, report := range reports {
+		result.Add(report.File)
+	}
+	result.Counts = result.Counts.WithoutDistinct()
+
+	output, err := json.Marshal(result)
+	if err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "error marshalling output: " + err.Error(),
+			IsBase64Encoded: false,
+		}, err
+	}
+
+	log.Println("merge successful")
+	return events.APIGatewayProxyResponse{
+		StatusCode:      200,
+		Body:            string(output),
+		IsBase64Encoded: false,
+	}, nil
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/forstmeier/comana/storage"
+)
+
+func TestMergeData(t *testing.T) {
+	tests := []struct {
+		desc          string
+		query         map[string]string
+		getReportsOut []storage.Report
+		getReportsErr error
+		status        int
+		counts        storage.Counts
+		err           string
+	}{
+		{
+			desc: "invalid query parameter",
+			query: map[string]string{
+				"end": "long ago",
+			},
+			status: 500,
+			err:    "invalid timestamp: long ago",
+		},
+		{
+			desc: "unfiltered query",
+			query: map[string]string{
+				"start": "1977-05-25T00",
+			},
+			status: 500,
+			err:    "a repo or owner parameter is required for report counts, request /load without query parameters for the report file paths of all repositories",
+		},
+		{
+			desc: "get reports error",
+			query: map[string]string{
+				"owner": "luke",
+			},
+			getReportsOut: nil,
+			getReportsErr: errors.New("get reports error"),
+			status:        500,
+			err:           "get reports error",
+		},
+		{
+			desc: "successful invocation",
+			query: map[string]string{
+				"start": "1977-05-25T00",
+				"end":   "1977-05-25T23",
+				"repo":  "luke/x-wing,han/falcon",
+			},
+			getReportsOut: []storage.Report{
+				{
+					File: storage.File{
+						Parsed: 2,
+						Counts: storage.Counts{
+							"luke/x-wing": {
+								"PushEvent": 2,
+								"actors":    1,
+							},
+						},
+					},
+				},
+				{
+					File: storage.File{
+						Parsed: 2,
+						Counts: storage.Counts{
+							"luke/x-wing": {
+								"PushEvent": 1,
+							},
+							"han/falcon": {
+								"ForkEvent": 1,
+							},
+						},
+					},
+				},
+			},
+			getReportsErr: nil,
+			status:        200,
+			counts: storage.Counts{
+				"luke/x-wing": {
+					"PushEvent": 3,
+				},
+				"han/falcon": {
+					"ForkEvent": 1,
+				},
+			},
+			err: "",
+		},
+	}
+
+	for _, test := range tests {
+		s := &mockStorage{
+			getReportsOut: test.getReportsOut,
+			getReportsErr: test.getReportsErr,
+		}
+
+		req := Request{
+			QueryStringParameters: test.query,
+		}
+
+		resp, err := MergeData(req, s)
+
+		if err != nil && err.Error() != test.err {
+			t.Errorf("description: %s, error received: %s, expected: %s", test.desc, err.Error(), test.err)
+		}
+
+		if resp.StatusCode != test.status {
+			t.Errorf("description: %s, status received: %d, expected: %d", test.desc, resp.StatusCode, test.status)
+		}
+
+		if test.counts == nil {
+			continue
+		}
+
+		output := merged{}
+		if err := json.Unmarshal([]byte(resp.Body), &output); err != nil {
+			t.Fatalf("description: %s, error decoding body: %s", test.desc, err.Error())
+		}
+
+		if output.Files != len(test.getReportsOut) || output.Parsed != 4 || !reflect.DeepEqual(output.Counts, test.counts) {
+			t.Errorf("description: %s, output received: %+v, expected counts: %+v", test.desc, output, test.counts)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"github.com/tidwall/gjson"
+
+	"github.com/forstmeier/comana/storage"
+)
+
+// metricsReport is the report type holding community health metrics
+const metricsReport = "per-repo-metrics"
+
+// metrics aggregates community health metrics per repository:
+//   - actors: distinct actor logins, left out of rollups and merges
+//   - commits: commits pushed according to PushEvent payload sizes
+//   - pull_requests_opened, pull_requests_closed, pull_requests_merged
+//   - issues_opened, issues_closed
+//   - stars and forks from WatchEvent and ForkEvent
+type metrics struct {
+	counts storage.Counts
+	actors map[string]map[string]struct{}
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		counts: storage.Counts{},
+		actors: map[string]map[string]struct{}{},
+	}
+}
+
+// Analyze records a single valid event line
+func (m *metrics) Analyze(line []byte) {
+	values := gjson.GetManyBytes(line, "type", "repo.name", "actor.login", "payload.size", "payload.action", "payload.pull_request.merged")
+	event, repo, actor, size, action, merged := values[0].String(), values[1].String(), values[2].String(), values[3].Int(), values[4].String(), values[5].Bool()
+
+	if _, ok := m.counts[repo]; !ok {
+		m.counts[repo] = map[string]int{}
+		m.actors[repo] = map[string]struct{}{}
+	}
+
+	if actor != "" {
+		m.actors[repo][actor] = struct{}{}
+	}
+
+	switch event {
+	case "PushEvent":
+		m.counts[repo]["commits"] += int(size)
+	case "PullRequestEvent":
+		switch {
+		case action == "opened":
+			m.counts[repo]["pull_requests_opened"]++
+		case action == "closed" && merged:
+			m.counts[repo]["pull_requests_merged"]++
+		case action == "closed":
+			m.counts[repo]["pull_requests_closed"]++
+		}
+	case "IssuesEvent":
+		switch action {
+		case "opened":
+			m.counts[repo]["issues_opened"]++
+		case "closed":
+			m.counts[repo]["issues_closed"]++
+		}
+	case "WatchEvent":
+		m.counts[repo]["stars"]++
+	case "ForkEvent":
+		m.counts[repo]["forks"]++
+	}
+}
+
+// Counts returns the aggregated metrics including distinct actor counts
+func (m *metrics) Counts() storage.Counts {
+	for repo, actors := range m.actors {
+		m.counts[repo]["actors"] = len(actors)
+	}
+	return m.counts
+}
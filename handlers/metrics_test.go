@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/forstmeier/comana/storage"
+)
+
+func Test_metrics(t *testing.T) {
+	lines := []string{
+		`{"type":"PushEvent","actor":{"login":"luke"},"repo":{"name":"rebels/x-wing"},"payload":{"size":3}}`,
+		`{"type":"PushEvent","actor":{"login":"luke"},"repo":{"name":"rebels/x-wing"},"payload":{"size":2}}`,
+		`{"type":"PullRequestEvent","actor":{"login":"leia"},"repo":{"name":"rebels/x-wing"},"payload":{"action":"opened","pull_request":{"merged":false}}}`,
+		`{"type":"PullRequestEvent","actor":{"login":"leia"},"repo":{"name":"rebels/x-wing"},"payload":{"action":"closed","pull_request":{"merged":true}}}`,
+		`{"type":"PullRequestEvent","actor":{"login":"han"},"repo":{"name":"rebels/x-wing"},"payload":{"action":"closed","pull_request":{"merged":false}}}`,
+		`{"type":"IssuesEvent","actor":{"login":"han"},"repo":{"name":"rebels/x-wing"},"payload":{"action":"opened"}}`,
+		`{"type":"IssuesEvent","actor":{"login":"han"},"repo":{"name":"rebels/x-wing"},"payload":{"action":"closed"}}`,
+		`{"type":"WatchEvent","actor":{"login":"vader"},"repo":{"name":"empire/death-star"},"payload":{"action":"started"}}`,
+		`{"type":"ForkEvent","actor":{"login":"vader"},"repo":{"name":"empire/death-star"},"payload":{}}`,
+	}
+
+	m := newMetrics()
+	for _, line := range lines {
+		m.Analyze([]byte(line))
+	}
+
+	expected := storage.Counts{
+		"rebels/x-wing": {
+			"actors":               3,
+			"commits":              5,
+			"pull_requests_opened": 1,
+			"pull_requests_merged": 1,
+			"pull_requests_closed": 1,
+			"issues_opened":        1,
+			"issues_closed":        1,
+		},
+		"empire/death-star": {
+			"actors": 1,
+			"stars":  1,
+			"forks":  1,
+		},
+	}
+
+	if output := m.Counts(); !reflect.DeepEqual(output, expected) {
+		t.Errorf("description: aggregated metrics, output received: %+v, expected: %+v", output, expected)
+	}
+}
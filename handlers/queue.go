@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+
+	"github.com/forstmeier/comana/storage"
+)
+
+// Message is a save request received from a Queue
+type Message struct {
+	Body    string
+	Receipt string
+}
+
+// Queue wraps an SQS-compatible queue used to fan out save requests;
+// received messages are redelivered unless they are deleted
+type Queue interface {
+	Send(body string) error
+	Receive(max int) ([]Message, error)
+	Delete(receipt string) error
+}
+
+type sqsAPI interface {
+	SendMessage(input *sqs.SendMessageInput) (*sqs.SendMessageOutput, error)
+	ReceiveMessage(input *sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessage(input *sqs.DeleteMessageInput) (*sqs.DeleteMessageOutput, error)
+}
+
+type sqsQueue struct {
+	sqs sqsAPI
+	url string
+}
+
+func (q *sqsQueue) Send(body string) error {
+	_, err := q.sqs.SendMessage(&sqs.SendMessageInput{
+		QueueUrl:    aws.String(q.url),
+		MessageBody: aws.String(body),
+	})
+	if err != nil {
+		return fmt.Errorf("error sending message: %s", err.Error())
+	}
+
+	return nil
+}
+
+// receiveWait is the long poll duration in seconds of SQS receives so
+// that an empty receive means the queue is empty rather than that the
+// sampled servers held no messages
+const receiveWait = 20
+
+func (q *sqsQueue) Receive(max int) ([]Message, error) {
+	output, err := q.sqs.ReceiveMessage(&sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(q.url),
+		MaxNumberOfMessages: aws.Int64(int64(max)),
+		WaitTimeSeconds:     aws.Int64(receiveWait),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error receiving messages: %s", err.Error())
+	}
+
+	messages := []Message{}
+	for _, message := range output.Messages {
+		messages = append(messages, Message{
+			Body:    aws.StringValue(message.Body),
+			Receipt: aws.StringValue(message.ReceiptHandle),
+		})
+	}
+
+	return messages, nil
+}
+
+func (q *sqsQueue) Delete(receipt string) error {
+	_, err := q.sqs.DeleteMessage(&sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(q.url),
+		ReceiptHandle: aws.String(receipt),
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting message: %s", err.Error())
+	}
+
+	return nil
+}
+
+// NewSQSQueue generates a Queue implementation with an active client for
+// the SQS queue at the URL
+func NewSQSQueue(url string) Queue {
+	return &sqsQueue{
+		sqs: sqs.New(session.New()),
+		url: url,
+	}
+}
+
+type localQueue struct {
+	mutex    sync.Mutex
+	next     int
+	pending  []Message
+	inFlight map[string]Message
+}
+
+func (q *localQueue) Send(body string) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.next++
+	q.pending = append(q.pending, Message{
+		Body:    body,
+		Receipt: strconv.Itoa(q.next),
+	})
+
+	return nil
+}
+
+func (q *localQueue) Receive(max int) ([]Message, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if max > len(q.pending) {
+		max = len(q.pending)
+	}
+
+	messages := q.pending[:max]
+	q.pending = q.pending[max:]
+	for _, message := range messages {
+		q.inFlight[message.Receipt] = message
+	}
+
+	return messages, nil
+}
+
+func (q *localQueue) Delete(receipt string) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if _, ok := q.inFlight[receipt]; !ok {
+		return errors.New("error deleting message: unknown receipt " + receipt)
+	}
+	delete(q.inFlight, receipt)
+
+	return nil
+}
+
+// NewLocalQueue generates an in-process Queue implementation; received
+// messages which are not deleted stay in flight rather than being
+// redelivered after a visibility timeout
+func NewLocalQueue() Queue {
+	return &localQueue{
+		pending:  []Message{},
+		inFlight: map[string]Message{},
+	}
+}
+
+type queueInvoke struct {
+	queue Queue
+}
+
+func (i *queueInvoke) Invoke(payload []byte) (int64, string, error) {
+	if err := i.queue.Send(string(payload)); err != nil {
+		return 0, "", err
+	}
+
+	return 202, "queued", nil
+}
+
+// NewQueueInvoke generates an Invoke implementation sending each save
+// request to the queue for a worker to process
+func NewQueueInvoke(q Queue) Invoker {
+	return &queueInvoke{
+		queue: q,
+	}
+}
+
+// NewInvokeFromConfig generates the Invoker for the named kind: "lambda"
+// (the default) or "async" invoking the target function, comana-save
+// unless given, or "queue" sending to the target SQS queue URL
+func NewInvokeFromConfig(kind, target string) (Invoker, error) {
+	switch kind {
+	case "", "lambda", "async":
+		if target == "" {
+			target = "comana-save"
+		}
+		return NewLambdaInvoke(target, kind == "async"), nil
+	case "queue":
+		if target == "" {
+			return nil, errors.New("queue url is required")
+		}
+		return NewQueueInvoke(NewSQSQueue(target)), nil
+	}
+
+	return nil, fmt.Errorf("unsupported invoker: %s", kind)
+}
+
+// Drain invokes the save of every message received from the queue until
+// a receive returns no messages, or only messages which already failed in
+// this run, deleting the messages which were saved; failed messages are
+// left for the queue to redeliver and the number saved is returned along
+// with an error when any failed
+func Drain(q Queue, i Invoker) (int, error) {
+	saved, failed, first := 0, 0, ""
+	failures := map[string]bool{}
+	for {
+		messages, err := q.Receive(10)
+		if err != nil {
+			return saved, err
+		}
+
+		retried := 0
+		for _, message := range messages {
+			if failures[message.Body] {
+				retried++
+			}
+		}
+
+		if retried == len(messages) {
+			break
+		}
+
+		for _, message := range messages {
+			if failures[message.Body] {
+				continue
+			}
+
+			code, resp, err := i.Invoke([]byte(message.Body))
+			if err == nil && code != 200 {
+				err = fmt.Errorf("status code %d, response: %s", code, resp)
+			}
+
+			if err == nil {
+				err = q.Delete(message.Receipt)
+			}
+
+			if err != nil {
+				log.Printf("error saving message %s: %s", message.Receipt, err.Error())
+				if failed == 0 {
+					first = err.Error()
+				}
+				failures[message.Body] = true
+				failed++
+				continue
+			}
+			saved++
+		}
+	}
+
+	if failed > 0 {
+		return saved, fmt.Errorf("failed for %d of %d messages, first error: %s", failed, saved+failed, first)
+	}
+
+	return saved, nil
+}
+
+// BatchItemFailure identifies a message of an SQS batch which failed
+type BatchItemFailure struct {
+	ItemIdentifier string `json:"itemIdentifier"`
+}
+
+// BatchResponse is the partial batch response of an SQS triggered Lambda;
+// only the listed messages are redelivered while the rest are deleted
+type BatchResponse struct {
+	BatchItemFailures []BatchItemFailure `json:"batchItemFailures"`
+}
+
+// WorkData saves the hour of each queued save request delivered to the
+// worker Lambda by an SQS trigger, returning the IDs of the messages which
+// failed so that only they are retried
+func WorkData(req Request, s storage.Storage) (BatchResponse, error) {
+	log.Printf("work request: %d records", len(req.Records))
+
+	output := BatchResponse{
+		BatchItemFailures: []BatchItemFailure{},
+	}
+	for _, record := range req.Records {
+		save := Request{}
+		err := json.Unmarshal([]byte(record.Body), &save)
+		if err == nil {
+			_, err = SaveData(save, s)
+		}
+
+		if err != nil {
+			log.Printf("error saving message %s: %s", record.MessageId, err.Error())
+			output.BatchItemFailures = append(output.BatchItemFailures, BatchItemFailure{
+				ItemIdentifier: record.MessageId,
+			})
+		}
+	}
+
+	log.Printf("work finished, failed: %d of %d messages", len(output.BatchItemFailures), len(req.Records))
+	return output, nil
+}
@@ -0,0 +1,418 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/sqs"
+
+	"github.com/forstmeier/comana/storage"
+)
+
+type mockLambda struct {
+	input  *lambda.InvokeInput
+	output *lambda.InvokeOutput
+	err    error
+}
+
+func (m *mockLambda) Invoke(input *lambda.InvokeInput) (*lambda.InvokeOutput, error) {
+	m.input = input
+	return m.output, m.err
+}
+
+func Test_clientInvoke(t *testing.T) {
+	tests := []struct {
+		desc           string
+		async          bool
+		output         *lambda.InvokeOutput
+		err            error
+		invocationType string
+		status         int64
+		resp           string
+	}{
+		{
+			desc:           "invocation error",
+			async:          false,
+			output:         nil,
+			err:            errors.New("invoke-error"),
+			invocationType: "",
+			status:         0,
+			resp:           "",
+		},
+		{
+			desc:  "synchronous invocation",
+			async: false,
+			output: &lambda.InvokeOutput{
+				StatusCode: aws.Int64(200),
+				Payload:    []byte(`"success"`),
+			},
+			err:            nil,
+			invocationType: "",
+			status:         200,
+			resp:           `"success"`,
+		},
+		{
+			desc:  "asynchronous invocation",
+			async: true,
+			output: &lambda.InvokeOutput{
+				StatusCode: aws.Int64(202),
+			},
+			err:            nil,
+			invocationType: "Event",
+			status:         202,
+			resp:           "",
+		},
+	}
+
+	for _, test := range tests {
+		m := &mockLambda{
+			output: test.output,
+			err:    test.err,
+		}
+
+		c := &client{
+			lambda:   m,
+			function: "comana-save-test",
+			async:    test.async,
+		}
+
+		status, resp, err := c.Invoke([]byte("{}"))
+		if err != test.err {
+			t.Errorf("description: %s, error received: %v, expected: %v", test.desc, err, test.err)
+		}
+
+		if status != test.status || resp != test.resp {
+			t.Errorf("description: %s, output received: %d %s, expected: %d %s", test.desc, status, resp, test.status, test.resp)
+		}
+
+		if function := aws.StringValue(m.input.FunctionName); function != "comana-save-test" {
+			t.Errorf("description: %s, function received: %s, expected: comana-save-test", test.desc, function)
+		}
+
+		if invocationType := aws.StringValue(m.input.InvocationType); invocationType != test.invocationType {
+			t.Errorf("description: %s, invocation type received: %s, expected: %s", test.desc, invocationType, test.invocationType)
+		}
+	}
+}
+
+func TestNewInvokeFromConfig(t *testing.T) {
+	tests := []struct {
+		kind   string
+		target string
+		err    string
+	}{
+		{"", "", ""},
+		{"async", "comana-save-async", ""},
+		{"queue", "", "queue url is required"},
+		{"queue", "https://sqs.us-east-1.amazonaws.com/123456789012/comana-save", ""},
+		{"carrier-pigeon", "", "unsupported invoker: carrier-pigeon"},
+	}
+
+	for _, test := range tests {
+		i, err := NewInvokeFromConfig(test.kind, test.target)
+		if err != nil {
+			if err.Error() != test.err {
+				t.Errorf("description: %s, error received: %s, expected: %s", test.kind, err.Error(), test.err)
+			}
+			continue
+		}
+
+		if i == nil || test.err != "" {
+			t.Errorf("description: %s, invoker received: %v, expected error: %s", test.kind, i, test.err)
+		}
+	}
+}
+
+type mockSQS struct {
+	bodies   []string
+	receipts []string
+	wait     int64
+	err      error
+}
+
+func (m *mockSQS) SendMessage(input *sqs.SendMessageInput) (*sqs.SendMessageOutput, error) {
+	m.bodies = append(m.bodies, aws.StringValue(input.MessageBody))
+	return &sqs.SendMessageOutput{}, m.err
+}
+
+func (m *mockSQS) ReceiveMessage(input *sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, error) {
+	m.wait = aws.Int64Value(input.WaitTimeSeconds)
+	output := &sqs.ReceiveMessageOutput{}
+	for i, body := range m.bodies {
+		output.Messages = append(output.Messages, &sqs.Message{
+			Body:          aws.String(body),
+			ReceiptHandle: aws.String(strconv.Itoa(i)),
+		})
+	}
+	m.bodies = nil
+	return output, m.err
+}
+
+func (m *mockSQS) DeleteMessage(input *sqs.DeleteMessageInput) (*sqs.DeleteMessageOutput, error) {
+	m.receipts = append(m.receipts, aws.StringValue(input.ReceiptHandle))
+	return &sqs.DeleteMessageOutput{}, m.err
+}
+
+func Test_sqsQueue(t *testing.T) {
+	m := &mockSQS{}
+	q := &sqsQueue{
+		sqs: m,
+		url: "queue-url",
+	}
+
+	for _, body := range []string{"first", "second"} {
+		if err := q.Send(body); err != nil {
+			t.Fatalf("description: send message, error received: %s", err.Error())
+		}
+	}
+
+	i := &mockInvoke{
+		invokeStatus: 200,
+	}
+
+	saved, err := Drain(q, i)
+	if err != nil || saved != 2 || strings.Join(m.receipts, ",") != "0,1" {
+		t.Errorf("description: drain queue, output received: %d %v %v", saved, m.receipts, err)
+	}
+
+	if m.wait != receiveWait {
+		t.Errorf("description: drain queue, wait received: %d, expected: %d", m.wait, receiveWait)
+	}
+
+	m.err = errors.New("sqs-error")
+	if err := q.Send("third"); err == nil || err.Error() != "error sending message: sqs-error" {
+		t.Errorf("description: send error, error received: %v", err)
+	}
+
+	if _, err := Drain(q, i); err == nil || err.Error() != "error receiving messages: sqs-error" {
+		t.Errorf("description: receive error, error received: %v", err)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	q := NewLocalQueue()
+	for _, body := range []string{"first", "second", "third"} {
+		q.Send(body)
+	}
+
+	saved, err := Drain(q, &mockInvoke{
+		invokeStatus: 500,
+		invokeResp:   "save-error",
+	})
+	if saved != 0 || err == nil || err.Error() != "failed for 3 of 3 messages, first error: status code 500, response: save-error" {
+		t.Errorf("description: failed saves, output received: %d %v", saved, err)
+	}
+
+	if err := q.Delete("1"); err != nil {
+		t.Errorf("description: failed messages stay in flight, error received: %s", err.Error())
+	}
+
+	if err := q.Delete("1"); err == nil || err.Error() != "error deleting message: unknown receipt 1" {
+		t.Errorf("description: deleted message, error received: %v", err)
+	}
+}
+
+// redeliveringQueue returns every message which has not been deleted on
+// each receive, as SQS does once their visibility timeout passes
+type redeliveringQueue struct {
+	bodies   []string
+	deleted  map[string]bool
+	receives int
+}
+
+func (q *redeliveringQueue) Send(body string) error {
+	q.bodies = append(q.bodies, body)
+	return nil
+}
+
+func (q *redeliveringQueue) Receive(max int) ([]Message, error) {
+	q.receives++
+	messages := []Message{}
+	for i, body := range q.bodies {
+		if receipt := strconv.Itoa(i); !q.deleted[receipt] && len(messages) < max {
+			messages = append(messages, Message{
+				Body:    body,
+				Receipt: receipt,
+			})
+		}
+	}
+	return messages, nil
+}
+
+func (q *redeliveringQueue) Delete(receipt string) error {
+	q.deleted[receipt] = true
+	return nil
+}
+
+type bodyInvoke struct {
+	failing string
+}
+
+func (b *bodyInvoke) Invoke(payload []byte) (int64, string, error) {
+	if string(payload) == b.failing {
+		return 500, "not found", nil
+	}
+	return 200, "success", nil
+}
+
+func TestDrainRedelivered(t *testing.T) {
+	q := &redeliveringQueue{
+		deleted: map[string]bool{},
+	}
+	for _, body := range []string{"first", "missing", "third"} {
+		q.Send(body)
+	}
+
+	saved, err := Drain(q, &bodyInvoke{
+		failing: "missing",
+	})
+	if saved != 2 || err == nil || err.Error() != "failed for 1 of 3 messages, first error: status code 500, response: not found" {
+		t.Errorf("description: redelivered failure, output received: %d %v", saved, err)
+	}
+
+	if q.receives != 2 {
+		t.Errorf("description: redelivered failure, receives received: %d, expected: 2", q.receives)
+	}
+}
+
+func TestQueuedBackfill(t *testing.T) {
+	os.Setenv("COMANA_SECRET", "test-secret")
+	s := storage.NewMemory("")
+	q := NewLocalQueue()
+
+	req := Request{
+		Headers: map[string]string{
+			"COMANA_SECRET": "test-secret",
+		},
+		Body: `{"from": "2019-05-25", "to": "2019-05-25"}`,
+	}
+
+	resp, err := BackfillData(req, NewQueueInvoke(q), s)
+	if err != nil {
+		t.Fatalf("description: queue backfill, error received: %s", err.Error())
+	}
+
+	job := storage.Job{}
+	json.Unmarshal([]byte(resp.Body), &job)
+	if job.Status != storage.Queued || job.Counts[storage.Queued] != 24 {
+		t.Errorf("description: queue backfill, job received: %s %v, expected: %s", job.Status, job.Counts, storage.Queued)
+	}
+
+	dwn, uzp, prs := download, unzip, parse
+	defer func() {
+		download, unzip, parse = dwn, uzp, prs
+	}()
+
+	download = func(string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader("")), nil
+	}
+	unzip = func(io.Reader) (*bufio.Reader, error) {
+		return nil, nil
+	}
+	parse = func(*bufio.Reader) (map[string]io.Reader, error) {
+		return map[string]io.Reader{
+			"per-repo-count": strings.NewReader(`{}`),
+		}, nil
+	}
+
+	saved, err := Drain(q, NewLocalInvoke(s))
+	if err != nil || saved != 24 {
+		t.Errorf("description: drain queue, output received: %d %v, expected: 24", saved, err)
+	}
+
+	day := time.Date(2019, 5, 25, 0, 0, 0, 0, time.UTC)
+	if missing, err := storage.MissingHours(s, "per-repo-count", day, day.Add(23*time.Hour)); err != nil || len(missing) != 0 {
+		t.Errorf("description: saved hours, missing received: %v %v", missing, err)
+	}
+
+	resp, err = JobData(Request{
+		QueryStringParameters: map[string]string{
+			"id": job.ID,
+		},
+	}, s)
+	if err != nil {
+		t.Fatalf("description: confirm queued hours, error received: %s", err.Error())
+	}
+
+	json.Unmarshal([]byte(resp.Body), &job)
+	if job.Status != storage.Done || job.Counts[storage.Done] != 24 {
+		t.Errorf("description: confirm queued hours, job received: %s %v, expected: %s", job.Status, job.Counts, storage.Done)
+	}
+}
+
+func TestWorkData(t *testing.T) {
+	tests := []struct {
+		desc     string
+		records  []string
+		failures []string
+	}{
+		{
+			desc:     "invalid message",
+			records:  []string{"not-json"},
+			failures: []string{"0"},
+		},
+		{
+			desc:     "save error",
+			records:  []string{`{"source": "comana.backfill", "year": 2019, "month": 5, "day": 25, "hour": 20}`, `{"source": "not-source"}`},
+			failures: []string{"1"},
+		},
+		{
+			desc:     "successful save",
+			records:  []string{`{"source": "comana.backfill", "year": 2019, "month": 5, "day": 25, "hour": 20}`},
+			failures: []string{},
+		},
+	}
+
+	dwn, uzp, prs := download, unzip, parse
+	defer func() {
+		download, unzip, parse = dwn, uzp, prs
+	}()
+
+	download = func(string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader("")), nil
+	}
+	unzip = func(io.Reader) (*bufio.Reader, error) {
+		return nil, nil
+	}
+	parse = func(*bufio.Reader) (map[string]io.Reader, error) {
+		return map[string]io.Reader{
+			"per-repo-count": strings.NewReader(`{}`),
+		}, nil
+	}
+
+	for _, test := range tests {
+		req := Request{}
+		for i, body := range test.records {
+			req.Records = append(req.Records, events.SQSMessage{
+				MessageId: strconv.Itoa(i),
+				Body:      body,
+			})
+		}
+
+		resp, err := WorkData(req, storage.NewMemory(""))
+		if err != nil {
+			t.Errorf("description: %s, error received: %s", test.desc, err.Error())
+		}
+
+		failures := []string{}
+		for _, failure := range resp.BatchItemFailures {
+			failures = append(failures, failure.ItemIdentifier)
+		}
+
+		if !reflect.DeepEqual(failures, test.failures) {
+			t.Errorf("description: %s, failures received: %v, expected: %v", test.desc, failures, test.failures)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/tidwall/gjson"
+
+	"github.com/forstmeier/comana/storage"
+)
+
+// reconcileWindow is the number of hours checked when no range is requested
+const reconcileWindow = 7 * 24
+
+// reconciliation lists the hours missing a stored report along with the
+// backfill job and summary when they were filled
+type reconciliation struct {
+	Report  string       `json:"report"`
+	From    time.Time    `json:"from"`
+	To      time.Time    `json:"to"`
+	Hours   int          `json:"hours"`
+	Missing []time.Time  `json:"missing"`
+	Job     *storage.Job `json:"job,omitempty"`
+	Summary *summary     `json:"summary,omitempty"`
+}
+
+// reconcileRange returns the body "from" and "to" hours, validated as for
+// backfills, defaulting to the week ending with the latest finished hour
+func reconcileRange(body string, now time.Time) (time.Time, time.Time, error) {
+	if !gjson.Get(body, "from").Exists() && !gjson.Get(body, "to").Exists() {
+		to := now.UTC().Truncate(time.Hour).Add(-time.Hour)
+		return to.Add(-(reconcileWindow - 1) * time.Hour), to, nil
+	}
+
+	hours, err := backfillHours(body, now)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	return hours[0], hours[len(hours)-1], nil
+}
+
+// ReconcileData finds the hours without a stored report of the body
+// "report" type, "per-repo-count" by default; when the body "fill" value
+// is true, or the request is a CloudWatch event, the missing hours are
+// backfilled as a new job
+//
+// Only requests without an HTTP method are treated as CloudWatch events,
+// and fills requested over HTTP always require the COMANA_SECRET header
+func ReconcileData(req Request, client Invoker, s storage.Storage) (events.APIGatewayProxyResponse, error) {
+	log.Printf("reconcile request: %s", req.Body)
+
+	scheduled := req.Source == "aws.events" && req.HTTPMethod == ""
+	fill := scheduled || gjson.Get(req.Body, "fill").Bool()
+	if !scheduled && fill {
+		if err := CheckSecret(req); err != nil {
+			return events.APIGatewayProxyResponse{
+				StatusCode:      500,
+				Body:            err.Error(),
+				IsBase64Encoded: false,
+			}, err
+		}
+	}
+
+	output := reconciliation{
+		Report: gjson.Get(req.Body, "report").String(),
+	}
+	if output.Report == "" {
+		output.Report = defaultReport
+	}
+
+	var err error
+	output.From, output.To, err = reconcileRange(req.Body, time.Now())
+	if err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "error reading reconcile range: " + err.Error(),
+			IsBase64Encoded: false,
+		}, err
+	}
+	output.Hours = int(output.To.Sub(output.From)/time.Hour) + 1
+
+	output.Missing, err = storage.MissingHours(s, output.Report, output.From, output.To)
+	if err != nil {
+		log.Println("error finding missing hours: " + err.Error())
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "error finding missing hours: " + err.Error(),
+			IsBase64Encoded: false,
+		}, err
+	}
+	log.Printf("report: %s, hours: %d, missing: %d", output.Report, output.Hours, len(output.Missing))
+
+	if fill && len(output.Missing) > 0 {
+		l, err := backfillLimits(req.Body)
+		if err != nil {
+			return events.APIGatewayProxyResponse{
+				StatusCode:      500,
+				Body:            "error reading backfill limits: " + err.Error(),
+				IsBase64Encoded: false,
+			}, err
+		}
+
+		job := storage.NewJob(output.Missing)
+		if err := storage.PutJob(s, &job); err != nil {
+			return events.APIGatewayProxyResponse{
+				StatusCode:      500,
+				Body:            "error creating backfill job: " + err.Error(),
+				IsBase64Encoded: false,
+			}, err
+		}
+		log.Printf("job: %s, hours: %d", job.ID, len(job.Hours))
+
+		result, err := runJob(&job, client, s, l)
+		if err != nil {
+			log.Println("error running backfill job: " + err.Error())
+			return events.APIGatewayProxyResponse{
+				StatusCode:      500,
+				Body:            "error running backfill job: " + err.Error(),
+				IsBase64Encoded: false,
+			}, err
+		}
+		output.Job, output.Summary = &job, &result
+	}
+
+	body, err := json.Marshal(output)
+	if err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "error marshalling output: " + err.Error(),
+			IsBase64Encoded: false,
+		}, err
+	}
+
+	log.Println("successful reconcile")
+	return events.APIGatewayProxyResponse{
+		StatusCode:      200,
+		Body:            string(body),
+		IsBase64Encoded: false,
+	}, nil
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/forstmeier/comana/storage"
+)
+
+func TestReconcileData(t *testing.T) {
+	tests := []struct {
+		desc       string
+		source     string
+		method     string
+		secret     string
+		body       string
+		listErr    bool
+		invokeErr  error
+		status     int
+		missing    int
+		hoursSaved int
+		err        string
+	}{
+		{
+			desc:    "invalid range",
+			body:    `{"from": "2019-05-25", "to": "2019-05-24"}`,
+			status:  500,
+			missing: 0,
+			err:     "to must not be before from",
+		},
+		{
+			desc:    "list keys error",
+			body:    `{"from": "2019-05-25", "to": "2019-05-25"}`,
+			listErr: true,
+			status:  500,
+			missing: 0,
+			err:     "error listing files",
+		},
+		{
+			desc:    "fill with incorrect secret",
+			secret:  "test-secret-failure",
+			body:    `{"from": "2019-05-25", "to": "2019-05-25", "fill": true}`,
+			status:  500,
+			missing: 0,
+			err:     "incorrect secret received: test-secret-failure",
+		},
+		{
+			desc:    "default range report",
+			body:    "",
+			status:  200,
+			missing: 168,
+			err:     "",
+		},
+		{
+			desc:    "missing hours report",
+			body:    `{"from": "2019-05-25", "to": "2019-05-25"}`,
+			status:  200,
+			missing: 22,
+			err:     "",
+		},
+		{
+			desc:    "other report type",
+			body:    `{"from": "2019-05-25", "to": "2019-05-25", "report": "per-org-count"}`,
+			status:  200,
+			missing: 24,
+			err:     "",
+		},
+		{
+			desc:      "fill failure",
+			secret:    "test-secret",
+			body:      `{"from": "2019-05-25", "to": "2019-05-25", "fill": true}`,
+			invokeErr: errors.New("invoke-error"),
+			status:    500,
+			missing:   0,
+			err:       "failed for 22 of 22 hours",
+		},
+		{
+			desc:       "fill missing hours",
+			secret:     "test-secret",
+			body:       `{"from": "2019-05-25", "to": "2019-05-25", "fill": true}`,
+			status:     200,
+			missing:    22,
+			hoursSaved: 22,
+			err:        "",
+		},
+		{
+			desc:       "http request with event source",
+			source:     "aws.events",
+			method:     "POST",
+			body:       "",
+			status:     200,
+			missing:    168,
+			hoursSaved: 0,
+			err:        "",
+		},
+		{
+			desc:    "http fill with event source and incorrect secret",
+			source:  "aws.events",
+			method:  "POST",
+			secret:  "test-secret-failure",
+			body:    `{"fill": true}`,
+			status:  500,
+			missing: 0,
+			err:     "incorrect secret received: test-secret-failure",
+		},
+		{
+			desc:       "scheduled fill",
+			source:     "aws.events",
+			body:       "",
+			status:     200,
+			missing:    168,
+			hoursSaved: 168,
+			err:        "",
+		},
+	}
+
+	os.Setenv("COMANA_SECRET", "test-secret")
+
+	for _, test := range tests {
+		m := storage.NewMemory("")
+		for _, hour := range []int{3, 17} {
+			m.PutFile(2019, 5, 25, hour, "per-repo-count", strings.NewReader(`{}`))
+		}
+
+		var s storage.Storage = m
+		if test.listErr {
+			s = &mockStorage{
+				listKeysErr: errors.New("error listing files"),
+			}
+		}
+
+		i := &mockInvoke{
+			invokeStatus: 200,
+			invokeResp:   "success",
+			invokeErr:    test.invokeErr,
+		}
+
+		r := Request{
+			Source:     test.source,
+			HTTPMethod: test.method,
+			Headers: map[string]string{
+				"COMANA_SECRET": test.secret,
+			},
+			Body: test.body,
+		}
+
+		resp, err := ReconcileData(r, i, s)
+		if err != nil && !strings.Contains(err.Error(), test.err) || err == nil && test.err != "" {
+			t.Errorf("description: %s, error received: %v, expected: %s", test.desc, err, test.err)
+		}
+
+		if resp.StatusCode != test.status {
+			t.Errorf("description: %s, status received: %d, expected: %d", test.desc, resp.StatusCode, test.status)
+		}
+
+		if test.status != 200 {
+			continue
+		}
+
+		output := reconciliation{}
+		json.Unmarshal([]byte(resp.Body), &output)
+
+		if len(output.Missing) != test.missing {
+			t.Errorf("description: %s, missing received: %d, expected: %d", test.desc, len(output.Missing), test.missing)
+		}
+
+		saved := 0
+		if output.Job != nil {
+			saved = output.Job.Counts[storage.Done]
+		}
+		if saved != test.hoursSaved {
+			t.Errorf("description: %s, hours saved received: %d, expected: %d", test.desc, saved, test.hoursSaved)
+		}
+	}
+}
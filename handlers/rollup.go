@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/forstmeier/comana/storage"
+)
+
+// rollup rebuilds the report file for the period beginning at start from
+// the finer-grained source period files, summed one file at a time;
+// rebuilding rather than appending keeps repeated runs from double
+// counting, and distinct counts are left out since they cannot be summed
+var rollup = func(s storage.Storage, period, source string, start time.Time, report string) error {
+	file, err := storage.SumReports(s, storage.Query{
+		Start:  start,
+		End:    storage.PeriodNext(period, start).Add(-time.Hour),
+		Period: source,
+		Report: report,
+	})
+	if err != nil {
+		return err
+	}
+	file.Counts = file.Counts.WithoutDistinct()
+
+	b, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+
+	return s.PutRollup(period, start, report, bytes.NewReader(b))
+}
+
+func init() {
+	RegisterSaveHook("rollups", rollupHook)
+}
+
+// staleRollupPrefix holds the markers of days saved again after they may
+// have been rolled up
+const staleRollupPrefix = "rollups/stale/"
+
+// rollupHook removes the saved hour's day reports, whose counts may now be
+// out of date, and marks the day for the next scheduled rollup to rebuild
+func rollupHook(s storage.Storage, t time.Time) error {
+	for _, report := range reportNames() {
+		if err := storage.DeleteRollup(s, storage.Day, t, report); err != nil {
+			return err
+		}
+	}
+
+	return storage.MarkStale(s, staleRollupPrefix, t)
+}
+
+// staleRollups returns the markers of days saved again keyed by day
+func staleRollups(s storage.Storage) (map[time.Time][]string, error) {
+	markers, err := storage.StaleMarkers(s, staleRollupPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	output := map[time.Time][]string{}
+	for t, keys := range markers {
+		day := storage.PeriodStart(storage.Day, t)
+		output[day] = append(output[day], keys...)
+	}
+
+	return output, nil
+}
+
+// maxStaleDays bounds the days saved again which a scheduled rollup
+// rebuilds so that it finishes within the Lambda time limit; the oldest
+// are rebuilt first and the rest by the following runs
+const maxStaleDays = 7
+
+// rollupDays rebuilds the day reports of the days and then the week and
+// month reports containing them, as those are built from the day files;
+// failures are returned along with the report and period being rolled up
+func rollupDays(s storage.Storage, days []time.Time) (string, error) {
+	for _, report := range reportNames() {
+		for _, day := range days {
+			if err := rollup(s, storage.Day, storage.Hour, day, report); err != nil {
+				return report + " day", err
+			}
+		}
+
+		periods := map[string]bool{}
+		for _, day := range days {
+			for _, period := range []string{storage.Week, storage.Month} {
+				start := storage.PeriodStart(period, day)
+				key := period + start.Format("2006-01-02")
+				if periods[key] {
+					continue
+				}
+				periods[key] = true
+
+				if err := rollup(s, period, storage.Day, start, report); err != nil {
+					return report + " " + period, err
+				}
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// RollupData merges hourly reports into day, week, and month reports;
+// scheduled runs roll up the previous day along with up to maxStaleDays
+// earlier days which were saved again since they were rolled up
+func RollupData(req Request, s storage.Storage) (events.APIGatewayProxyResponse, error) {
+	log.Printf("rollup request: %s", req.Body)
+
+	if req.Source != "aws.events" && req.Source != "comana.rollup" {
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "source must be cloudwatch event or rollup",
+			IsBase64Encoded: false,
+		}, errors.New("source must be cloudwatch event or rollup")
+	}
+
+	stale, err := staleRollups(s)
+	if err != nil {
+		log.Println("error listing stale rollups: " + err.Error())
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "error listing stale rollups: " + err.Error(),
+			IsBase64Encoded: false,
+		}, err
+	}
+
+	day := time.Date(req.Year, time.Month(req.Month), req.Day, 0, 0, 0, 0, time.UTC)
+	days := []time.Time{day}
+	if req.Source == "aws.events" {
+		day = storage.PeriodStart(storage.Day, time.Now().UTC().AddDate(0, 0, -1))
+		earlier := []time.Time{}
+		for staleDay := range stale {
+			if staleDay.Before(day) {
+				earlier = append(earlier, staleDay)
+			}
+		}
+		sort.Slice(earlier, func(i, j int) bool {
+			return earlier[i].Before(earlier[j])
+		})
+		if len(earlier) > maxStaleDays {
+			earlier = earlier[:maxStaleDays]
+		}
+		days = append(earlier, day)
+	}
+	sort.Slice(days, func(i, j int) bool {
+		return days[i].Before(days[j])
+	})
+	log.Printf("source: %s, day: %s, days: %d", req.Source, day.Format("2006-01-02"), len(days))
+
+	if failed, err := rollupDays(s, days); err != nil {
+		log.Printf("error rolling up %s: %s", failed, err.Error())
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            fmt.Sprintf("error rolling up %s: %s", failed, err.Error()),
+			IsBase64Encoded: false,
+		}, err
+	}
+
+	for _, day := range days {
+		for _, key := range stale[day] {
+			if err := s.DeleteObject(key); err != nil {
+				log.Printf("error clearing stale rollup marker %s: %s", key, err.Error())
+			}
+		}
+	}
+
+	log.Println("successful rollup")
+	return events.APIGatewayProxyResponse{
+		StatusCode:      200,
+		Body:            "success",
+		IsBase64Encoded: false,
+	}, nil
+}
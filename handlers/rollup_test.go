@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/forstmeier/comana/storage"
+)
+
+func Test_rollup(t *testing.T) {
+	s := storage.NewMemory("")
+	for day, file := range map[int]string{
+		1:  `{"parsed":1,"skipped":0,"counts":{"luke/x-wing":{"PushEvent":1}}}`,
+		25: `{"parsed":2,"skipped":1,"counts":{"luke/x-wing":{"PushEvent":2,"actors":2},"han/falcon":{"actors":1}}}`,
+	} {
+		if err := s.PutRollup(storage.Day, time.Date(1977, 5, day, 0, 0, 0, 0, time.UTC), "per-repo-count", strings.NewReader(file)); err != nil {
+			t.Fatalf("description: put day rollup, error received: %s", err.Error())
+		}
+	}
+	s.PutRollup(storage.Day, time.Date(1977, 6, 1, 0, 0, 0, 0, time.UTC), "per-repo-count", strings.NewReader(`{"luke/x-wing":{"PushEvent":9}}`))
+
+	start := time.Date(1977, 5, 1, 0, 0, 0, 0, time.UTC)
+	if err := rollup(s, storage.Month, storage.Day, start, "per-repo-count"); err != nil {
+		t.Fatalf("description: rollup month, error received: %s", err.Error())
+	}
+
+	// repeated runs must overwrite rather than accumulate
+	if err := rollup(s, storage.Month, storage.Day, start, "per-repo-count"); err != nil {
+		t.Fatalf("description: repeat rollup month, error received: %s", err.Error())
+	}
+
+	expected := storage.File{
+		Parsed:  3,
+		Skipped: 1,
+		Counts: storage.Counts{
+			"luke/x-wing": {
+				"PushEvent": 3,
+			},
+		},
+	}
+
+	reports, err := s.GetReports(storage.Query{
+		Start:  start,
+		End:    start,
+		Period: storage.Month,
+		Report: "per-repo-count",
+	})
+	if err != nil || len(reports) != 1 || !reflect.DeepEqual(reports[0].File, expected) {
+		t.Errorf("description: rollup month, output received: %+v %v, expected: %+v", reports, err, expected)
+	}
+}
+
+func TestRollupData(t *testing.T) {
+	tests := []struct {
+		desc         string
+		src          string
+		listKeysErr  error
+		putRollupErr error
+		status       int
+		err          string
+	}{
+		{
+			desc:         "incorrect source",
+			src:          "not-source",
+			listKeysErr:  nil,
+			putRollupErr: nil,
+			status:       500,
+			err:          "source must be cloudwatch event or rollup",
+		},
+		{
+			desc:         "list keys error",
+			src:          "aws.events",
+			listKeysErr:  errors.New("list keys error"),
+			putRollupErr: nil,
+			status:       500,
+			err:          "list keys error",
+		},
+		{
+			desc:         "put rollup error",
+			src:          "comana.rollup",
+			listKeysErr:  nil,
+			putRollupErr: errors.New("put rollup error"),
+			status:       500,
+			err:          "put rollup error",
+		},
+		{
+			desc:         "successful invocation",
+			src:          "comana.rollup",
+			listKeysErr:  nil,
+			putRollupErr: nil,
+			status:       200,
+			err:          "",
+		},
+	}
+
+	for _, test := range tests {
+		s := &mockStorage{
+			listKeysErr:  test.listKeysErr,
+			putRollupErr: test.putRollupErr,
+		}
+
+		req := Request{
+			Source: test.src,
+			Year:   1977,
+			Month:  5,
+			Day:    25,
+		}
+
+		resp, err := RollupData(req, s)
+
+		if err != nil && err.Error() != test.err {
+			t.Errorf("description: %s, error received: %s, expected: %s", test.desc, err.Error(), test.err)
+		}
+
+		if resp.StatusCode != test.status {
+			t.Errorf("description: %s, status received: %d, expected: %d", test.desc, resp.StatusCode, test.status)
+		}
+	}
+}
+
+func TestRollupDataStale(t *testing.T) {
+	s := storage.NewMemory("")
+	day := time.Date(2019, 5, 25, 0, 0, 0, 0, time.UTC)
+	hour := day.Add(20 * time.Hour)
+
+	s.PutFile(2019, 5, 25, 20, defaultReport, strings.NewReader(`{"counts":{"luke/x-wing":{"PushEvent":1}}}`))
+	if _, err := RollupData(Request{Source: "comana.rollup", Year: 2019, Month: 5, Day: 25}, s); err != nil {
+		t.Fatalf("description: initial rollup, error received: %s", err.Error())
+	}
+
+	s.PutFile(2019, 5, 25, 20, defaultReport, strings.NewReader(`{"counts":{"luke/x-wing":{"PushEvent":3}}}`))
+	if err := rollupHook(s, hour); err != nil {
+		t.Fatalf("description: rollup hook, error received: %s", err.Error())
+	}
+
+	if keys, _ := s.ListKeys("day/2019/05/25/" + defaultReport); len(keys) != 0 {
+		t.Errorf("description: stale day rollup removed, keys received: %v", keys)
+	}
+
+	if keys, _ := s.ListKeys(staleRollupPrefix); len(keys) != 1 {
+		t.Errorf("description: stale day marked, keys received: %v", keys)
+	}
+
+	if _, err := RollupData(Request{Source: "aws.events"}, s); err != nil {
+		t.Fatalf("description: scheduled rollup, error received: %s", err.Error())
+	}
+
+	reports, err := s.GetReports(storage.Query{
+		Start:  day,
+		End:    day,
+		Period: storage.Day,
+		Report: defaultReport,
+	})
+	if err != nil || len(reports) != 1 || reports[0].Counts["luke/x-wing"]["PushEvent"] != 3 {
+		t.Errorf("description: stale day rebuilt, output received: %+v %v", reports, err)
+	}
+
+	if keys, _ := s.ListKeys(staleRollupPrefix); len(keys) != 0 {
+		t.Errorf("description: stale markers cleared, keys received: %v", keys)
+	}
+}
+
+func TestRollupDataStaleLimit(t *testing.T) {
+	s := storage.NewMemory("")
+	for i := 0; i < maxStaleDays+2; i++ {
+		if err := rollupHook(s, time.Date(2019, 5, 1+i, 20, 0, 0, 0, time.UTC)); err != nil {
+			t.Fatalf("description: rollup hook, error received: %s", err.Error())
+		}
+	}
+
+	if _, err := RollupData(Request{Source: "aws.events"}, s); err != nil {
+		t.Fatalf("description: scheduled rollup, error received: %s", err.Error())
+	}
+
+	keys, _ := s.ListKeys(staleRollupPrefix)
+	if len(keys) != 2 || !strings.HasPrefix(keys[0], staleRollupPrefix+"2019/05/08/") {
+		t.Errorf("description: oldest stale days rebuilt, keys received: %v", keys)
+	}
+}
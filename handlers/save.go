@@ -2,76 +2,109 @@ package handlers
 
 import (
 	"bufio"
+	"bytes"
 	"compress/gzip"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"net/http"
-	"strings"
+	"sort"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
-	"github.com/tidwall/gjson"
 
 	"github.com/forstmeier/comana/storage"
 )
 
-var download = func(url string) ([]byte, error) {
+// download opens a streaming body for the archive file; callers must close it
+var download = func(url string) (io.ReadCloser, error) {
 	resp, err := http.Get(url)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	respData, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status code %d for %s", resp.StatusCode, url)
 	}
 
-	return respData, nil
+	return resp.Body, nil
 }
 
-var unzip = func(input []byte) (*bufio.Scanner, error) {
-	r := strings.NewReader(string(input))
-
-	gz, err := gzip.NewReader(r)
+// unzip decompresses the archive as it is read rather than buffering it
+var unzip = func(input io.Reader) (*bufio.Reader, error) {
+	gz, err := gzip.NewReader(input)
 	if err != nil {
 		return nil, err
 	}
 
-	return bufio.NewScanner(gz), nil
+	return bufio.NewReader(gz), nil
 }
 
-var parse = func(s *bufio.Scanner) (io.Reader, error) {
-	data := make(map[string]map[string]int)
-	for s.Scan() {
-		line := s.Text()
+// readLine reads a full line of any length into the reusable buffer
+func readLine(r *bufio.Reader, buf []byte) ([]byte, error) {
+	buf = buf[:0]
+	for {
+		chunk, err := r.ReadSlice('\n')
+		buf = append(buf, chunk...)
+		if err != bufio.ErrBufferFull {
+			return buf, err
+		}
+	}
+}
 
-		event := gjson.Get(line, "type").String()
-		repo := gjson.Get(line, "repo.name").String()
+// parse feeds each valid event line to a fresh instance of every registered
+// analyzer one line at a time so only the aggregates are held in memory;
+// lines which are not valid events are skipped and counted while read
+// errors from truncated or corrupt archives are returned; output readers
+// are keyed by report type
+var parse = func(r *bufio.Reader) (map[string]io.Reader, error) {
+	active := map[string]Analyzer{}
+	for name, fn := range analyzers {
+		active[name] = fn()
+	}
+	parsed, skipped := 0, 0
+
+	var line []byte
+	for {
+		var err error
+		line, err = readLine(r, line)
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("error reading line %d: %s", parsed+skipped+1, err.Error())
+		}
 
-		if _, repoExists := data[repo]; repoExists {
-			if _, eventExists := data[repo][event]; eventExists {
-				data[repo][event]++
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			if validEvent(trimmed) {
+				for _, analyzer := range active {
+					analyzer.Analyze(trimmed)
+				}
+				parsed++
 			} else {
-				data[repo][event] = 1
-			}
-		} else {
-			data[repo] = map[string]int{
-				event: 1,
+				skipped++
 			}
 		}
+
+		if err == io.EOF {
+			break
+		}
 	}
 
-	b, err := json.Marshal(data)
-	if err != nil {
-		return nil, err
+	output := map[string]io.Reader{}
+	for name, analyzer := range active {
+		b, err := json.Marshal(storage.File{
+			Parsed:  parsed,
+			Skipped: skipped,
+			Counts:  analyzer.Counts(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		output[name] = bytes.NewReader(b)
 	}
 
-	return strings.NewReader(string(b)), nil
+	return output, nil
 }
 
 // SaveData pulls in and parses GitHub Archive data
@@ -95,7 +128,7 @@ func SaveData(req Request, s storage.Storage) (events.APIGatewayProxyResponse, e
 	}
 	log.Printf("source: %s, year: %d, month: %d, start day: %d, end day: %d", req.Source, year, month, day, hour)
 
-	url := fmt.Sprintf("https://data.gharchive.org/%d-%02d-%02d-%d.json.gz", year, month, day, hour)
+	url := archiveURL(time.Date(year, time.Month(month), day, hour, 0, 0, 0, time.UTC))
 	log.Printf("gh archive url: %s", url)
 
 	file, err := download(url)
@@ -107,8 +140,9 @@ func SaveData(req Request, s storage.Storage) (events.APIGatewayProxyResponse, e
 			IsBase64Encoded: false,
 		}, err
 	}
+	defer file.Close()
 
-	scanner, err := unzip(file)
+	lines, err := unzip(file)
 	if err != nil {
 		log.Println("error unzipping archive file: " + err.Error())
 		return events.APIGatewayProxyResponse{
@@ -118,7 +152,7 @@ func SaveData(req Request, s storage.Storage) (events.APIGatewayProxyResponse, e
 		}, err
 	}
 
-	reader, err := parse(scanner)
+	readers, err := parse(lines)
 	if err != nil {
 		log.Println("error parsing archive file: " + err.Error())
 		return events.APIGatewayProxyResponse{
@@ -128,14 +162,38 @@ func SaveData(req Request, s storage.Storage) (events.APIGatewayProxyResponse, e
 		}, err
 	}
 
-	if err := s.PutFile(year, month, day, hour, "per-repo-count", reader); err != nil {
-		log.Println("error saving report file: " + err.Error())
-		return events.APIGatewayProxyResponse{
-			StatusCode:      500,
-			Body:            "error saving report file: " + err.Error(),
-			IsBase64Encoded: false,
-		}, err
+	reports := []string{}
+	for report := range readers {
+		reports = append(reports, report)
 	}
+	sort.Strings(reports)
+
+	// the hour is marked stale in the index before its reports are written
+	// so that the save hooks and later repository queries read them
+	saved := time.Date(year, time.Month(month), day, hour, 0, 0, 0, time.UTC)
+	for _, report := range reports {
+		if err := storage.InvalidateIndex(s, report, saved); err != nil {
+			log.Println("error invalidating index: " + err.Error())
+			return events.APIGatewayProxyResponse{
+				StatusCode:      500,
+				Body:            "error invalidating index: " + err.Error(),
+				IsBase64Encoded: false,
+			}, err
+		}
+	}
+
+	for _, report := range reports {
+		if err := s.PutFile(year, month, day, hour, report, readers[report]); err != nil {
+			log.Println("error saving report file: " + err.Error())
+			return events.APIGatewayProxyResponse{
+				StatusCode:      500,
+				Body:            "error saving report file: " + err.Error(),
+				IsBase64Encoded: false,
+			}, err
+		}
+	}
+
+	runSaveHooks(s, saved)
 
 	log.Println("successful save")
 	return events.APIGatewayProxyResponse{
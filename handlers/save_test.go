@@ -4,15 +4,35 @@ import (
 	"bufio"
 	"bytes"
 	"compress/gzip"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/forstmeier/comana/storage"
 )
 
 func Test_download(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/1977-05-25-20.json.gz" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("archive"))
+	}))
+	defer server.Close()
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
 	tests := []struct {
 		desc string
 		url  string
@@ -20,24 +40,37 @@ func Test_download(t *testing.T) {
 	}{
 		{
 			"bad url",
-			"https://temp.com",
-			"Get https://temp.com: dial tcp 23.23.86.44:443: connect: connection refused",
+			closed.URL,
+			"connection refused",
+		},
+		{
+			"missing archive",
+			server.URL + "/1977-05-25-21.json.gz",
+			"unexpected status code 404 for " + server.URL + "/1977-05-25-21.json.gz",
 		},
 		{
 			"good url",
-			"https://data.gharchive.org/2019-01-01-15.json.gz",
+			server.URL + "/1977-05-25-20.json.gz",
 			"",
 		},
 	}
 
 	for _, test := range tests {
 		file, err := download(test.url)
-		if err != nil && err.Error() != test.err {
+		if err != nil && !strings.Contains(err.Error(), test.err) {
 			t.Errorf("description: %s, received: %s, expected: %s", test.desc, err.Error(), test.err)
 		}
 
-		if err == nil && file == nil {
-			t.Errorf("description: %s, no output file found", test.desc)
+		if err == nil && test.err != "" {
+			t.Errorf("description: %s, no error received, expected: %s", test.desc, test.err)
+		}
+
+		if err == nil {
+			if file == nil {
+				t.Errorf("description: %s, no output file found", test.desc)
+				continue
+			}
+			file.Close()
 		}
 	}
 }
@@ -71,7 +104,7 @@ func Test_unzip(t *testing.T) {
 			log.Fatalf("error creating test gzip resource %s", err.Error())
 		}
 
-		_, err = unzip(buf.Bytes())
+		_, err = unzip(&buf)
 
 		if err != nil && err.Error() != test.err {
 			t.Errorf("description: %s, received: %s, expected: %s", test.desc, err.Error(), test.err)
@@ -79,36 +112,110 @@ func Test_unzip(t *testing.T) {
 	}
 }
 
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) {
+	return 0, io.ErrUnexpectedEOF
+}
+
 func Test_parse(t *testing.T) {
 	tests := []struct {
 		desc string
-		scnr *bufio.Scanner
 		rdr  io.Reader
+		file storage.File
 		err  string
 	}{
 		{
 			desc: "successful invocation with single value",
-			scnr: bufio.NewScanner(
-				strings.NewReader(`{"type": "test-event", "repo":{"name": "test-repo"}}`),
-			),
-			rdr: strings.NewReader("test-reader"),
+			rdr:  strings.NewReader(`{"type": "test-event", "repo":{"name": "test-repo"}}`),
+			file: storage.File{
+				Parsed:  1,
+				Skipped: 0,
+				Counts: storage.Counts{
+					"test-repo": {
+						"test-event": 1,
+					},
+				},
+			},
 			err: "",
 		},
 		{
 			desc: "successful invocation with multiple values",
-			scnr: bufio.NewScanner(
-				strings.NewReader(`{"type": "test-event", "repo":{"name": "test-repo"}}\n{"type": "test-event", "repo":{"name": "test-repo"}}`),
-			),
-			rdr: strings.NewReader("test-reader"),
+			rdr:  strings.NewReader(`{"type": "test-event", "repo":{"name": "test-repo"}}` + "\n" + `{"type": "test-event", "repo":{"name": "test-repo"}}` + "\n"),
+			file: storage.File{
+				Parsed:  2,
+				Skipped: 0,
+				Counts: storage.Counts{
+					"test-repo": {
+						"test-event": 2,
+					},
+				},
+			},
 			err: "",
 		},
+		{
+			desc: "successful invocation with line over scanner limit",
+			rdr:  strings.NewReader(`{"type": "PushEvent", "repo":{"name": "test-repo"}, "payload":{"message": "` + strings.Repeat("a", 100000) + `"}}` + "\n" + `{"type": "WatchEvent", "repo":{"name": "test-repo"}}`),
+			file: storage.File{
+				Parsed:  2,
+				Skipped: 0,
+				Counts: storage.Counts{
+					"test-repo": {
+						"PushEvent":  1,
+						"WatchEvent": 1,
+					},
+				},
+			},
+			err: "",
+		},
+		{
+			desc: "successful invocation with skipped lines",
+			rdr:  strings.NewReader(`{"type": "test-event", "repo":{"name": "test-repo"}}` + "\n" + `{"type": "test-ev` + "\n" + `{"type": "test-event"}` + "\n\n"),
+			file: storage.File{
+				Parsed:  1,
+				Skipped: 2,
+				Counts: storage.Counts{
+					"test-repo": {
+						"test-event": 1,
+					},
+				},
+			},
+			err: "",
+		},
+		{
+			desc: "truncated input",
+			rdr:  io.MultiReader(strings.NewReader(`{"type": "test-event", "repo":{"name": "test-repo"}}`+"\n"), errReader{}),
+			file: storage.File{},
+			err:  "error reading line 2: unexpected EOF",
+		},
 	}
 
 	for _, test := range tests {
-		_, err := parse(test.scnr)
+		output, err := parse(bufio.NewReader(test.rdr))
 		if err != nil && err.Error() != test.err {
 			t.Errorf("description: %s, received: %s, expected: %s", test.desc, err.Error(), test.err)
 		}
+
+		if err == nil && test.err != "" {
+			t.Errorf("description: %s, no error received, expected: %s", test.desc, test.err)
+		}
+
+		if err != nil {
+			continue
+		}
+
+		if _, ok := output[metricsReport]; !ok {
+			t.Errorf("description: %s, no metrics report found", test.desc)
+		}
+
+		file := storage.File{}
+		if err := json.NewDecoder(output[defaultReport]).Decode(&file); err != nil {
+			t.Fatalf("description: %s, error decoding output: %s", test.desc, err.Error())
+		}
+
+		if !reflect.DeepEqual(file, test.file) {
+			t.Errorf("description: %s, output received: %+v, expected: %+v", test.desc, file, test.file)
+		}
 	}
 }
 
@@ -116,9 +223,9 @@ func TestSaveData(t *testing.T) {
 	tests := []struct {
 		desc   string
 		src    string
-		dwn    func(url string) ([]byte, error)
-		uzp    func([]byte) (*bufio.Scanner, error)
-		prs    func(s *bufio.Scanner) (io.Reader, error)
+		dwn    func(url string) (io.ReadCloser, error)
+		uzp    func(io.Reader) (*bufio.Reader, error)
+		prs    func(r *bufio.Reader) (map[string]io.Reader, error)
 		dbErr  error
 		status int
 		err    string
@@ -126,7 +233,7 @@ func TestSaveData(t *testing.T) {
 		{
 			desc: "incorrect source",
 			src:  "not-source",
-			dwn: func(string) ([]byte, error) {
+			dwn: func(string) (io.ReadCloser, error) {
 				return nil, errors.New("download error")
 			},
 			uzp:    nil,
@@ -138,7 +245,7 @@ func TestSaveData(t *testing.T) {
 		{
 			desc: "archive download error",
 			src:  "aws.events",
-			dwn: func(string) ([]byte, error) {
+			dwn: func(string) (io.ReadCloser, error) {
 				return nil, errors.New("download error")
 			},
 			uzp:    nil,
@@ -150,10 +257,10 @@ func TestSaveData(t *testing.T) {
 		{
 			desc: "archive unzip error",
 			src:  "aws.events",
-			dwn: func(string) ([]byte, error) {
-				return nil, nil
+			dwn: func(string) (io.ReadCloser, error) {
+				return ioutil.NopCloser(strings.NewReader("")), nil
 			},
-			uzp: func([]byte) (*bufio.Scanner, error) {
+			uzp: func(io.Reader) (*bufio.Reader, error) {
 				return nil, errors.New("unzip error")
 			},
 			prs:    nil,
@@ -164,13 +271,13 @@ func TestSaveData(t *testing.T) {
 		{
 			desc: "archive parse error",
 			src:  "aws.events",
-			dwn: func(string) ([]byte, error) {
-				return nil, nil
+			dwn: func(string) (io.ReadCloser, error) {
+				return ioutil.NopCloser(strings.NewReader("")), nil
 			},
-			uzp: func([]byte) (*bufio.Scanner, error) {
+			uzp: func(io.Reader) (*bufio.Reader, error) {
 				return nil, nil
 			},
-			prs: func(s *bufio.Scanner) (io.Reader, error) {
+			prs: func(r *bufio.Reader) (map[string]io.Reader, error) {
 				return nil, errors.New("parse error")
 			},
 			dbErr:  nil,
@@ -180,14 +287,16 @@ func TestSaveData(t *testing.T) {
 		{
 			desc: "put file error",
 			src:  "aws.events",
-			dwn: func(string) ([]byte, error) {
-				return nil, nil
+			dwn: func(string) (io.ReadCloser, error) {
+				return ioutil.NopCloser(strings.NewReader("")), nil
 			},
-			uzp: func([]byte) (*bufio.Scanner, error) {
+			uzp: func(io.Reader) (*bufio.Reader, error) {
 				return nil, nil
 			},
-			prs: func(s *bufio.Scanner) (io.Reader, error) {
-				return strings.NewReader("test"), nil
+			prs: func(r *bufio.Reader) (map[string]io.Reader, error) {
+				return map[string]io.Reader{
+					"per-repo-count": strings.NewReader("test"),
+				}, nil
 			},
 			dbErr:  errors.New("put file error"),
 			status: 500,
@@ -196,14 +305,16 @@ func TestSaveData(t *testing.T) {
 		{
 			desc: "successful invocation",
 			src:  "aws.events",
-			dwn: func(string) ([]byte, error) {
-				return nil, nil
+			dwn: func(string) (io.ReadCloser, error) {
+				return ioutil.NopCloser(strings.NewReader("")), nil
 			},
-			uzp: func([]byte) (*bufio.Scanner, error) {
+			uzp: func(io.Reader) (*bufio.Reader, error) {
 				return nil, nil
 			},
-			prs: func(s *bufio.Scanner) (io.Reader, error) {
-				return strings.NewReader("test"), nil
+			prs: func(r *bufio.Reader) (map[string]io.Reader, error) {
+				return map[string]io.Reader{
+					"per-repo-count": strings.NewReader("test"),
+				}, nil
 			},
 			dbErr:  nil,
 			status: 200,
@@ -211,6 +322,11 @@ func TestSaveData(t *testing.T) {
 		},
 	}
 
+	dwn, uzp, prs := download, unzip, parse
+	defer func() {
+		download, unzip, parse = dwn, uzp, prs
+	}()
+
 	for _, test := range tests {
 		s := &mockStorage{
 			putFileErr: test.dbErr,
@@ -235,3 +351,47 @@ func TestSaveData(t *testing.T) {
 		}
 	}
 }
+
+// syntheticArchive generates a gzipped archive of event lines spread across
+// a number of repositories
+func syntheticArchive(lines int) []byte {
+	var buf bytes.Buffer
+
+	w := gzip.NewWriter(&buf)
+	for i := 0; i < lines; i++ {
+		fmt.Fprintf(w, `{"id":"%d","type":"PushEvent","actor":{"login":"actor-%d"},"repo":{"name":"owner-%d/repo-%d"},"payload":{"size":1}}`+"\n", i, i%500, i%50, i%1000)
+	}
+	w.Close()
+
+	return buf.Bytes()
+}
+
+func Benchmark_pipeline(b *testing.B) {
+	archive := syntheticArchive(100000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	}))
+	defer server.Close()
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(archive)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		file, err := download(server.URL)
+		if err != nil {
+			b.Fatalf("error downloading archive: %s", err.Error())
+		}
+
+		lines, err := unzip(file)
+		if err != nil {
+			b.Fatalf("error unzipping archive: %s", err.Error())
+		}
+
+		if _, err := parse(lines); err != nil {
+			b.Fatalf("error parsing archive: %s", err.Error())
+		}
+
+		file.Close()
+	}
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/forstmeier/comana/storage"
+)
+
+// defaultSeriesWindow is the number of days covered when no start
+// parameter is provided
+const defaultSeriesWindow = 28
+
+// point holds the event counts of a single series bucket
+type point struct {
+	Time   time.Time      `json:"time"`
+	Total  int            `json:"total"`
+	Counts map[string]int `json:"counts"`
+}
+
+// series is the ordered bucket list returned by SeriesData
+type series struct {
+	Repo   string    `json:"repo"`
+	Report string    `json:"report"`
+	Bucket string    `json:"bucket"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Points []point   `json:"points"`
+}
+
+// seriesQuery converts request parameters into an hourly query for a single
+// repository along with the bucket period; the window defaults to the most
+// recent four weeks and is widened to whole buckets
+func seriesQuery(req Request) (storage.Query, string, error) {
+	q, err := parseQuery(req)
+	if err != nil {
+		return storage.Query{}, "", err
+	}
+
+	if len(q.Repos) != 1 {
+		return storage.Query{}, "", errors.New("a single repo parameter is required")
+	}
+
+	bucket := req.param("bucket")
+	if bucket == "" {
+		bucket = storage.Day
+	}
+	if !storage.ValidPeriod(bucket) {
+		return storage.Query{}, "", errors.New("invalid bucket: " + bucket)
+	}
+
+	if req.param("start") == "" {
+		q.Start = q.End.AddDate(0, 0, -defaultSeriesWindow).Add(time.Hour)
+	}
+
+	if q.Start.After(q.End) {
+		return storage.Query{}, "", errors.New("start must not be after end")
+	}
+
+	q.Start = storage.PeriodStart(bucket, q.Start)
+	q.End = storage.PeriodNext(bucket, storage.PeriodStart(bucket, q.End)).Add(-time.Hour)
+	q.Period = storage.Hour
+	q.Owners = nil
+
+	return q, bucket, nil
+}
+
+// buildSeries sums the reports into consecutive buckets between start and
+// end, including buckets without any activity and leaving out distinct
+// counts which cannot be added up
+func buildSeries(reports []storage.Report, bucket string, start, end time.Time) []point {
+	points := []point{}
+	index := map[time.Time]int{}
+	for current := storage.PeriodStart(bucket, start); !current.After(end); current = storage.PeriodNext(bucket, current) {
+		index[current] = len(points)
+		points = append(points, point{
+			Time:   current,
+			Counts: map[string]int{},
+		})
+	}
+
+	for _, report := range reports {
+		i, ok := index[storage.PeriodStart(bucket, report.Time)]
+		if !ok {
+			continue
+		}
+
+		for _, repoEvents := range report.Counts.WithoutDistinct() {
+			for event, count := range repoEvents {
+				points[i].Counts[event] += count
+				points[i].Total += count
+			}
+		}
+	}
+
+	return points
+}
+
+// SeriesData returns the event counts of a single repository as an ordered
+// series of hourly, daily, weekly, or monthly buckets
+func SeriesData(req Request, s storage.Storage) (events.APIGatewayProxyResponse, error) {
+	log.Println("series request")
+
+	q, bucket, err := seriesQuery(req)
+	if err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "error parsing query: " + err.Error(),
+			IsBase64Encoded: false,
+		}, err
+	}
+	log.Printf("query start: %s, end: %s, bucket: %s, report: %s, repo: %s, types: %v", q.Start, q.End, bucket, q.Report, q.Repos[0], q.Events)
+
+	reports, err := s.GetReports(q)
+	if err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "error loading reports: " + err.Error(),
+			IsBase64Encoded: false,
+		}, err
+	}
+
+	seriesObject := series{
+		Repo:   q.Repos[0],
+		Report: q.Report,
+		Bucket: bucket,
+		Start:  q.Start,
+		End:    q.End,
+		Points: buildSeries(reports, bucket, q.Start, q.End),
+	}
+
+	output, err := json.Marshal(seriesObject)
+	if err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "error marshalling output: " + err.Error(),
+			IsBase64Encoded: false,
+		}, err
+	}
+
+	log.Println("series successful")
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers: map[string]string{
+			"result_count": strconv.Itoa(len(seriesObject.Points)),
+		},
+		Body:            string(output),
+		IsBase64Encoded: false,
+	}, nil
+}
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/forstmeier/comana/storage"
+)
+
+func Test_seriesQuery(t *testing.T) {
+	tests := []struct {
+		desc   string
+		query  map[string]string
+		start  time.Time
+		end    time.Time
+		bucket string
+		err    string
+	}{
+		{
+			desc:  "missing repo",
+			query: map[string]string{},
+			err:   "a single repo parameter is required",
+		},
+		{
+			desc: "multiple repos",
+			query: map[string]string{
+				"repo": "luke/x-wing,han/falcon",
+			},
+			err: "a single repo parameter is required",
+		},
+		{
+			desc: "invalid bucket",
+			query: map[string]string{
+				"repo":   "luke/x-wing",
+				"bucket": "decade",
+			},
+			err: "invalid bucket: decade",
+		},
+		{
+			desc: "reversed window",
+			query: map[string]string{
+				"repo":  "luke/x-wing",
+				"start": "1977-05-26T00",
+				"end":   "1977-05-25T00",
+			},
+			err: "start must not be after end",
+		},
+		{
+			desc: "window widened to whole weeks",
+			query: map[string]string{
+				"repo":   "luke/x-wing",
+				"bucket": "week",
+				"start":  "1977-05-25T10",
+				"end":    "1977-06-01T10",
+			},
+			start:  time.Date(1977, 5, 23, 0, 0, 0, 0, time.UTC),
+			end:    time.Date(1977, 6, 5, 23, 0, 0, 0, time.UTC),
+			bucket: "week",
+		},
+		{
+			desc: "default window and bucket",
+			query: map[string]string{
+				"repo": "luke/x-wing",
+				"end":  "1977-05-25T10",
+			},
+			start:  time.Date(1977, 4, 27, 0, 0, 0, 0, time.UTC),
+			end:    time.Date(1977, 5, 25, 23, 0, 0, 0, time.UTC),
+			bucket: "day",
+		},
+	}
+
+	for _, test := range tests {
+		q, bucket, err := seriesQuery(Request{
+			QueryStringParameters: test.query,
+		})
+
+		if err != nil {
+			if err.Error() != test.err {
+				t.Errorf("description: %s, error received: %s, expected: %s", test.desc, err.Error(), test.err)
+			}
+			continue
+		}
+
+		if !q.Start.Equal(test.start) || !q.End.Equal(test.end) || bucket != test.bucket || q.Period != storage.Hour {
+			t.Errorf("description: %s, output received: %s %s %s %s, expected: %s %s %s", test.desc, q.Start, q.End, bucket, q.Period, test.start, test.end, test.bucket)
+		}
+	}
+}
+
+func Test_buildSeries(t *testing.T) {
+	reports := []storage.Report{
+		{
+			Time: time.Date(1977, 5, 25, 10, 0, 0, 0, time.UTC),
+			File: storage.File{
+				Counts: storage.Counts{
+					"luke/x-wing": {"PushEvent": 2, "WatchEvent": 1, "actors": 2},
+				},
+			},
+		},
+		{
+			Time: time.Date(1977, 5, 25, 20, 0, 0, 0, time.UTC),
+			File: storage.File{
+				Counts: storage.Counts{
+					"luke/x-wing": {"PushEvent": 1, "actors": 1},
+				},
+			},
+		},
+		{
+			Time: time.Date(1977, 5, 27, 0, 0, 0, 0, time.UTC),
+			File: storage.File{
+				Counts: storage.Counts{
+					"luke/x-wing": {"ForkEvent": 4},
+				},
+			},
+		},
+	}
+
+	expected := []point{
+		{
+			Time:   time.Date(1977, 5, 25, 0, 0, 0, 0, time.UTC),
+			Total:  4,
+			Counts: map[string]int{"PushEvent": 3, "WatchEvent": 1},
+		},
+		{
+			Time:   time.Date(1977, 5, 26, 0, 0, 0, 0, time.UTC),
+			Total:  0,
+			Counts: map[string]int{},
+		},
+		{
+			Time:   time.Date(1977, 5, 27, 0, 0, 0, 0, time.UTC),
+			Total:  4,
+			Counts: map[string]int{"ForkEvent": 4},
+		},
+	}
+
+	start := time.Date(1977, 5, 25, 0, 0, 0, 0, time.UTC)
+	end := time.Date(1977, 5, 27, 23, 0, 0, 0, time.UTC)
+	if output := buildSeries(reports, storage.Day, start, end); !reflect.DeepEqual(output, expected) {
+		t.Errorf("description: daily buckets with a gap and distinct counts, output received: %+v, expected: %+v", output, expected)
+	}
+}
+
+func TestSeriesData(t *testing.T) {
+	tests := []struct {
+		desc          string
+		query         map[string]string
+		getReportsOut []storage.Report
+		getReportsErr error
+		status        int
+		points        int
+		err           string
+	}{
+		{
+			desc:   "missing repo",
+			query:  map[string]string{},
+			status: 500,
+			err:    "a single repo parameter is required",
+		},
+		{
+			desc: "get reports error",
+			query: map[string]string{
+				"repo": "luke/x-wing",
+			},
+			getReportsErr: errors.New("get reports error"),
+			status:        500,
+			err:           "get reports error",
+		},
+		{
+			desc: "successful invocation",
+			query: map[string]string{
+				"repo":   "luke/x-wing",
+				"bucket": "hour",
+				"start":  "1977-05-25T00",
+				"end":    "1977-05-25T23",
+			},
+			getReportsOut: []storage.Report{
+				{
+					Time: time.Date(1977, 5, 25, 20, 0, 0, 0, time.UTC),
+					File: storage.File{
+						Counts: storage.Counts{
+							"luke/x-wing": {"PushEvent": 1},
+						},
+					},
+				},
+			},
+			status: 200,
+			points: 24,
+		},
+	}
+
+	for _, test := range tests {
+		s := &mockStorage{
+			getReportsOut: test.getReportsOut,
+			getReportsErr: test.getReportsErr,
+		}
+
+		resp, err := SeriesData(Request{
+			QueryStringParameters: test.query,
+		}, s)
+
+		if err != nil && err.Error() != test.err {
+			t.Errorf("description: %s, error received: %s, expected: %s", test.desc, err.Error(), test.err)
+		}
+
+		if resp.StatusCode != test.status {
+			t.Errorf("description: %s, status received: %d, expected: %d", test.desc, resp.StatusCode, test.status)
+		}
+
+		if test.points == 0 {
+			continue
+		}
+
+		output := series{}
+		if err := json.Unmarshal([]byte(resp.Body), &output); err != nil {
+			t.Fatalf("description: %s, error decoding body: %s", test.desc, err.Error())
+		}
+
+		if len(output.Points) != test.points || output.Points[20].Total != 1 {
+			t.Errorf("description: %s, output received: %+v, expected points: %d", test.desc, output, test.points)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/forstmeier/comana/stats"
+	"github.com/forstmeier/comana/storage"
+)
+
+// defaultWindow and defaultHorizon are the moving average window and
+// number of forecast buckets used when no parameters are provided
+const (
+	defaultWindow  = 7
+	defaultHorizon = 4
+)
+
+// statPoint holds a series bucket total along with its trend statistics
+type statPoint struct {
+	Time    time.Time `json:"time"`
+	Total   int       `json:"total"`
+	Average float64   `json:"average"`
+	Delta   *float64  `json:"delta,omitempty"`
+	Change  *float64  `json:"change,omitempty"`
+}
+
+// projection holds a forecast bucket total
+type projection struct {
+	Time  time.Time `json:"time"`
+	Total float64   `json:"total"`
+}
+
+// statsPage holds the trend statistics and forecast of a repository series;
+// Lag is the number of buckets each delta and change compares against
+type statsPage struct {
+	Repo     string       `json:"repo"`
+	Report   string       `json:"report"`
+	Bucket   string       `json:"bucket"`
+	Start    time.Time    `json:"start"`
+	End      time.Time    `json:"end"`
+	Window   int          `json:"window"`
+	Lag      int          `json:"lag"`
+	Points   []statPoint  `json:"points"`
+	Forecast []projection `json:"forecast"`
+	Model    *stats.Holt  `json:"model,omitempty"`
+}
+
+// lag returns the number of buckets in a week for hour and day buckets so
+// changes are week over week, and a single bucket otherwise
+func lag(bucket string) int {
+	switch bucket {
+	case storage.Hour:
+		return 168
+	case storage.Day:
+		return 7
+	}
+	return 1
+}
+
+// positiveParam returns the integer value of a query string parameter of
+// at most defaultLimit, or the fallback when it is not provided
+func positiveParam(req Request, key string, fallback int) (int, error) {
+	value := req.param(key)
+	if value == "" {
+		return fallback, nil
+	}
+
+	v, err := strconv.Atoi(value)
+	if err != nil || v < 1 || v > defaultLimit {
+		return 0, errors.New("invalid " + key + ": " + value)
+	}
+	return v, nil
+}
+
+func loadStats(req Request, s storage.Storage) (events.APIGatewayProxyResponse, error) {
+	var window, horizon int
+	q, bucket, err := seriesQuery(req)
+	if err == nil {
+		window, err = positiveParam(req, "window", defaultWindow)
+	}
+	if err == nil {
+		horizon, err = positiveParam(req, "horizon", defaultHorizon)
+	}
+	if err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "error parsing query: " + err.Error(),
+			IsBase64Encoded: false,
+		}, err
+	}
+	log.Printf("stats query start: %s, end: %s, bucket: %s, report: %s, repo: %s, window: %d, horizon: %d", q.Start, q.End, bucket, q.Report, q.Repos[0], window, horizon)
+
+	reports, err := s.GetReports(q)
+	if err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "error loading reports: " + err.Error(),
+			IsBase64Encoded: false,
+		}, err
+	}
+
+	points := buildSeries(reports, bucket, q.Start, q.End)
+	values := []float64{}
+	for _, p := range points {
+		values = append(values, float64(p.Total))
+	}
+
+	statsObject := statsPage{
+		Repo:     q.Repos[0],
+		Report:   q.Report,
+		Bucket:   bucket,
+		Start:    q.Start,
+		End:      q.End,
+		Window:   window,
+		Lag:      lag(bucket),
+		Points:   []statPoint{},
+		Forecast: []projection{},
+	}
+
+	averages := stats.MovingAverage(values, window)
+	deltas := stats.Deltas(values, statsObject.Lag)
+	changes := stats.PercentChanges(values, statsObject.Lag)
+	for i, p := range points {
+		statsObject.Points = append(statsObject.Points, statPoint{
+			Time:    p.Time,
+			Total:   p.Total,
+			Average: averages[i],
+			Delta:   deltas[i],
+			Change:  changes[i],
+		})
+	}
+
+	// series too short to fit are returned without a forecast
+	if model, err := stats.FitHolt(values); err == nil {
+		statsObject.Model = &model
+
+		next := storage.PeriodNext(bucket, points[len(points)-1].Time)
+		for _, total := range model.Forecast(horizon) {
+			statsObject.Forecast = append(statsObject.Forecast, projection{
+				Time:  next,
+				Total: math.Max(total, 0), // activity cannot be negative
+			})
+			next = storage.PeriodNext(bucket, next)
+		}
+	}
+
+	output, err := json.Marshal(statsObject)
+	if err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "error marshalling output: " + err.Error(),
+			IsBase64Encoded: false,
+		}, err
+	}
+
+	log.Println("load stats successful")
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers: map[string]string{
+			"result_count": strconv.Itoa(len(statsObject.Points)),
+		},
+		Body:            string(output),
+		IsBase64Encoded: false,
+	}, nil
+}
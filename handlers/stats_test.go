@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/forstmeier/comana/storage"
+)
+
+func TestLoadDataStats(t *testing.T) {
+	reports := []storage.Report{}
+	for day := 0; day < 10; day++ {
+		reports = append(reports, storage.Report{
+			Time: time.Date(1977, 5, 16+day, 12, 0, 0, 0, time.UTC),
+			File: storage.File{
+				Counts: storage.Counts{
+					"luke/x-wing": {"PushEvent": 10 + 2*day},
+				},
+			},
+		})
+	}
+
+	tests := []struct {
+		desc          string
+		query         map[string]string
+		getReportsOut []storage.Report
+		getReportsErr error
+		status        int
+		forecast      int
+		err           string
+	}{
+		{
+			desc: "invalid window",
+			query: map[string]string{
+				"mode":   "stats",
+				"repo":   "luke/x-wing",
+				"window": "none",
+			},
+			status: 500,
+			err:    "invalid window: none",
+		},
+		{
+			desc: "horizon above limit",
+			query: map[string]string{
+				"mode":    "stats",
+				"repo":    "luke/x-wing",
+				"horizon": "1000000000",
+			},
+			status: 500,
+			err:    "invalid horizon: 1000000000",
+		},
+		{
+			desc: "get reports error",
+			query: map[string]string{
+				"mode": "stats",
+				"repo": "luke/x-wing",
+			},
+			getReportsErr: errors.New("get reports error"),
+			status:        500,
+			err:           "get reports error",
+		},
+		{
+			desc: "single bucket without forecast",
+			query: map[string]string{
+				"mode":  "stats",
+				"repo":  "luke/x-wing",
+				"start": "1977-05-16T00",
+				"end":   "1977-05-16T23",
+			},
+			getReportsOut: reports[:1],
+			status:        200,
+			forecast:      0,
+		},
+		{
+			desc: "successful invocation",
+			query: map[string]string{
+				"mode":    "stats",
+				"repo":    "luke/x-wing",
+				"start":   "1977-05-16T00",
+				"end":     "1977-05-25T23",
+				"window":  "3",
+				"horizon": "2",
+			},
+			getReportsOut: reports,
+			status:        200,
+			forecast:      2,
+		},
+	}
+
+	for _, test := range tests {
+		s := &mockStorage{
+			getReportsOut: test.getReportsOut,
+			getReportsErr: test.getReportsErr,
+		}
+
+		resp, err := LoadData(Request{
+			QueryStringParameters: test.query,
+		}, s)
+
+		if err != nil && err.Error() != test.err {
+			t.Errorf("description: %s, error received: %s, expected: %s", test.desc, err.Error(), test.err)
+		}
+
+		if resp.StatusCode != test.status {
+			t.Errorf("description: %s, status received: %d, expected: %d", test.desc, resp.StatusCode, test.status)
+		}
+
+		if test.status != 200 {
+			continue
+		}
+
+		output := statsPage{}
+		if err := json.Unmarshal([]byte(resp.Body), &output); err != nil {
+			t.Fatalf("description: %s, error decoding body: %s", test.desc, err.Error())
+		}
+
+		if len(output.Forecast) != test.forecast || (test.forecast == 0) != (output.Model == nil) {
+			t.Errorf("description: %s, forecast received: %+v, model received: %+v", test.desc, output.Forecast, output.Model)
+		}
+
+		if test.forecast == 0 {
+			continue
+		}
+
+		last := output.Points[len(output.Points)-1]
+		if last.Total != 28 || last.Average != 26 || *last.Delta != 14 || *last.Change != 100 {
+			t.Errorf("description: %s, point received: %+v", test.desc, last)
+		}
+
+		expected := time.Date(1977, 5, 26, 0, 0, 0, 0, time.UTC)
+		if first := output.Forecast[0]; !first.Time.Equal(expected) || first.Total < 29 || first.Total > 31 {
+			t.Errorf("description: %s, forecast received: %+v, expected time: %s", test.desc, first, expected)
+		}
+	}
+}
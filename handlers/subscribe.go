@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/forstmeier/comana/storage"
+	"github.com/forstmeier/comana/webhook"
+)
+
+func init() {
+	RegisterSaveHook("webhooks", webhookHook)
+}
+
+// webhookSender delivers payloads to subscribers after each save
+var webhookSender = webhook.NewSender()
+
+// webhookTimeout bounds the total time a save spends delivering payloads,
+// after which undelivered payloads are stored as dead letters
+var webhookTimeout = 30 * time.Second
+
+// subscriptionsPage wraps every stored subscription
+type subscriptionsPage struct {
+	Subscriptions []webhook.Subscription `json:"subscriptions"`
+}
+
+// deadLettersPage wraps stored dead-letter records
+type deadLettersPage struct {
+	DeadLetters []webhook.DeadLetter `json:"dead_letters"`
+}
+
+// webhookHook concurrently posts the saved hour's event counts for each
+// subscription's repositories to its URL; every subscription is attempted
+// within the timeout before the failures are returned
+func webhookHook(s storage.Storage, t time.Time) error {
+	subs, err := webhook.Subscriptions(s)
+	if err != nil || len(subs) == 0 {
+		return err
+	}
+
+	reports, err := s.GetReports(storage.Query{
+		Start:  t,
+		End:    t,
+		Period: storage.Hour,
+		Report: defaultReport,
+	})
+	if err != nil {
+		return err
+	}
+
+	counts := storage.Counts{}
+	for _, report := range reports {
+		counts.Add(report.Counts)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	failed := []error{}
+	for _, sub := range subs {
+		wg.Add(1)
+		go func(sub webhook.Subscription) {
+			defer wg.Done()
+			err := webhook.Deliver(ctx, s, webhookSender, sub, webhook.Payload{
+				Time:   t,
+				Report: defaultReport,
+				Counts: counts.Filter(sub.Repos, nil, nil),
+			})
+			if err != nil {
+				mutex.Lock()
+				failed = append(failed, err)
+				mutex.Unlock()
+			}
+		}(sub)
+	}
+	wg.Wait()
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d webhook deliveries failed, first error: %s", len(failed), len(subs), failed[0].Error())
+	}
+
+	return nil
+}
+
+// SubscribeData lists webhook subscriptions, or the dead-letter records of
+// the subscription set by the dead_letters parameter ("all" for every
+// subscription), with GET requests; creates a subscription from the body
+// url, secret, and repos with POST requests, returning the generated secret
+// only when none was provided; and removes the body id subscription with
+// DELETE requests
+func SubscribeData(req Request, s storage.Storage) (events.APIGatewayProxyResponse, error) {
+	log.Printf("subscribe request: %s", req.HTTPMethod)
+
+	var output interface{}
+	err := CheckSecret(req)
+
+	if err == nil {
+		switch req.HTTPMethod {
+		case "", "GET":
+			output, err = getSubscriptions(req, s)
+		case "POST":
+			sub := webhook.Subscription{}
+			if err = json.Unmarshal([]byte(req.Body), &sub); err == nil {
+				provided := sub.Secret != ""
+				sub, err = webhook.Subscribe(s, sub)
+				if provided {
+					sub.Secret = ""
+				}
+				output = sub
+			}
+		case "DELETE":
+			sub := webhook.Subscription{}
+			if err = json.Unmarshal([]byte(req.Body), &sub); err == nil {
+				err = webhook.Unsubscribe(s, sub.ID)
+				output = sub
+			}
+		default:
+			err = errors.New("unsupported method: " + req.HTTPMethod)
+		}
+	}
+
+	if err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "error handling subscription: " + err.Error(),
+			IsBase64Encoded: false,
+		}, err
+	}
+
+	body, err := json.Marshal(output)
+	if err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "error marshalling output: " + err.Error(),
+			IsBase64Encoded: false,
+		}, err
+	}
+
+	log.Println("subscribe successful")
+	return events.APIGatewayProxyResponse{
+		StatusCode:      200,
+		Body:            string(body),
+		IsBase64Encoded: false,
+	}, nil
+}
+
+func getSubscriptions(req Request, s storage.Storage) (interface{}, error) {
+	if id := req.param("dead_letters"); id != "" {
+		if id == "all" {
+			id = ""
+		}
+
+		letters, err := webhook.DeadLetters(s, id)
+		return deadLettersPage{
+			DeadLetters: letters,
+		}, err
+	}
+
+	subs, err := webhook.Subscriptions(s)
+	for i := range subs {
+		subs[i].Secret = ""
+	}
+
+	return subscriptionsPage{
+		Subscriptions: subs,
+	}, err
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/forstmeier/comana/storage"
+	"github.com/forstmeier/comana/webhook"
+)
+
+func Test_webhookHook(t *testing.T) {
+	defer func(original *webhook.Sender) {
+		webhookSender = original
+	}(webhookSender)
+	webhookSender = &webhook.Sender{
+		Client:   http.DefaultClient,
+		Attempts: 2,
+	}
+
+	received := []webhook.Payload{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		p := webhook.Payload{}
+		json.NewDecoder(r.Body).Decode(&p)
+		received = append(received, p)
+	}))
+	defer server.Close()
+
+	s := storage.NewMemory("")
+	now := time.Date(1977, 5, 25, 20, 0, 0, 0, time.UTC)
+	if err := s.PutFile(1977, 5, 25, 20, defaultReport, strings.NewReader(`{"luke/x-wing":{"PushEvent":1},"han/falcon":{"ForkEvent":1}}`)); err != nil {
+		t.Fatalf("description: put file, error received: %s", err.Error())
+	}
+
+	if err := webhookHook(s, now); err != nil {
+		t.Fatalf("description: no subscriptions, error received: %s", err.Error())
+	}
+
+	for _, sub := range []webhook.Subscription{
+		{URL: server.URL + "/hook", Repos: []string{"luke/x-wing"}},
+		{URL: server.URL + "/broken"},
+	} {
+		if _, err := webhook.Subscribe(s, sub); err != nil {
+			t.Fatalf("description: subscribe, error received: %s", err.Error())
+		}
+	}
+
+	err := webhookHook(s, now)
+	if err == nil || !strings.HasPrefix(err.Error(), "1 of 2 webhook deliveries failed") {
+		t.Errorf("description: partial failure, error received: %v", err)
+	}
+
+	if len(received) != 1 || len(received[0].Counts) != 1 || received[0].Counts["luke/x-wing"]["PushEvent"] != 1 {
+		t.Errorf("description: filtered delivery, payloads received: %+v", received)
+	}
+
+	if letters, _ := webhook.DeadLetters(s, ""); len(letters) != 1 || letters[0].Attempts != 2 {
+		t.Errorf("description: dead letter, output received: %+v", letters)
+	}
+}
+
+func TestSubscribeData(t *testing.T) {
+	os.Setenv("COMANA_SECRET", "test-secret")
+	s := storage.NewMemory("")
+
+	tests := []struct {
+		desc   string
+		method string
+		secret string
+		query  map[string]string
+		body   string
+		status int
+		output string
+	}{
+		{
+			desc:   "incorrect secret",
+			method: "GET",
+			secret: "wrong-secret",
+			status: 500,
+			output: "error handling subscription: incorrect secret received: wrong-secret",
+		},
+		{
+			desc:   "invalid url",
+			method: "POST",
+			secret: "test-secret",
+			body:   `{"url":"example.com"}`,
+			status: 500,
+			output: "error handling subscription: invalid url: example.com",
+		},
+		{
+			desc:   "subscribe",
+			method: "POST",
+			secret: "test-secret",
+			body:   `{"url":"https://example.com/hook","secret":"hook-secret","repos":["luke/x-wing"]}`,
+			status: 200,
+			output: `"url":"https://example.com/hook","repos":["luke/x-wing"]}`,
+		},
+		{
+			desc:   "list subscriptions without secrets",
+			method: "GET",
+			secret: "test-secret",
+			status: 200,
+			output: `"url":"https://example.com/hook","repos":["luke/x-wing"]}]}`,
+		},
+		{
+			desc:   "list dead letters",
+			method: "GET",
+			secret: "test-secret",
+			query: map[string]string{
+				"dead_letters": "all",
+			},
+			status: 200,
+			output: `{"dead_letters":[]}`,
+		},
+		{
+			desc:   "unsubscribe invalid id",
+			method: "DELETE",
+			secret: "test-secret",
+			body:   `{"id":"not-an-id"}`,
+			status: 500,
+			output: "error handling subscription: invalid subscription id: not-an-id",
+		},
+	}
+
+	for _, test := range tests {
+		req := Request{
+			HTTPMethod: test.method,
+			Body:       test.body,
+			Headers: map[string]string{
+				"COMANA_SECRET": test.secret,
+			},
+			QueryStringParameters: test.query,
+		}
+
+		resp, _ := SubscribeData(req, s)
+
+		if resp.StatusCode != test.status {
+			t.Errorf("description: %s, status received: %d, expected: %d", test.desc, resp.StatusCode, test.status)
+		}
+
+		if !strings.HasSuffix(resp.Body, test.output) {
+			t.Errorf("description: %s, body received: %s, expected suffix: %s", test.desc, resp.Body, test.output)
+		}
+	}
+
+	resp, err := SubscribeData(Request{
+		HTTPMethod: "POST",
+		Body:       `{"url":"https://example.com/generated"}`,
+		Headers: map[string]string{
+			"COMANA_SECRET": "test-secret",
+		},
+	}, s)
+	if err != nil {
+		t.Fatalf("description: subscribe with generated secret, error received: %s", err.Error())
+	}
+
+	sub := webhook.Subscription{}
+	json.Unmarshal([]byte(resp.Body), &sub)
+	if len(sub.Secret) != 64 {
+		t.Errorf("description: subscribe with generated secret, body received: %s", resp.Body)
+	}
+}
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/forstmeier/comana/storage"
+)
+
+// defaultTop is the number of repositories ranked when no n parameter is
+// provided
+const defaultTop = 10
+
+// ranking holds a repository's event count for a period along with its
+// change from the previous period; Change is a percentage and is omitted
+// when the repository had no previous activity
+type ranking struct {
+	Repo     string   `json:"repo"`
+	Count    int      `json:"count"`
+	Previous int      `json:"previous"`
+	Delta    int      `json:"delta"`
+	Change   *float64 `json:"change,omitempty"`
+}
+
+// topPage holds the repositories ranked by count and by growth for a period
+type topPage struct {
+	Period string    `json:"period"`
+	Start  time.Time `json:"start"`
+	Report string    `json:"report"`
+	Types  []string  `json:"types,omitempty"`
+	Top    []ranking `json:"top"`
+	Growth []ranking `json:"growth"`
+}
+
+// topQuery converts request parameters into a query for a single day, week,
+// or month period along with the number of repositories to rank; the
+// period defaults to the most recent complete day
+func topQuery(req Request) (storage.Query, int, error) {
+	n := defaultTop
+	if value := req.param("n"); value != "" {
+		v, err := strconv.Atoi(value)
+		if err != nil || v < 1 || v > defaultLimit {
+			return storage.Query{}, 0, errors.New("invalid n: " + value)
+		}
+		n = v
+	}
+
+	period := req.param("period")
+	if period == "" {
+		period = storage.Day
+	}
+	if period != storage.Day && period != storage.Week && period != storage.Month {
+		return storage.Query{}, 0, errors.New("invalid period: " + period)
+	}
+
+	start := storage.PeriodStart(period, storage.PeriodStart(period, time.Now()).Add(-time.Hour))
+	if value := req.param("start"); value != "" {
+		t, err := parseTime(value)
+		if err != nil {
+			return storage.Query{}, 0, err
+		}
+		start = storage.PeriodStart(period, t)
+	}
+
+	report := req.param("report")
+	if report == "" {
+		report = defaultReport
+	}
+
+	return storage.Query{
+		Start:  start,
+		End:    start,
+		Period: period,
+		Report: report,
+		Repos:  req.params("repo"),
+		Owners: req.params("owner"),
+		Events: req.params("type"),
+	}, n, nil
+}
+
+// periodCounts returns the counts of the period beginning at the query
+// start, summing its hourly reports when it has not been rolled up yet and
+// leaving out distinct counts which cannot be added up
+func periodCounts(s storage.Storage, q storage.Query) (storage.Counts, error) {
+	reports, err := s.GetReports(q)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(reports) == 0 {
+		hourly := q
+		hourly.Period = storage.Hour
+		hourly.End = storage.PeriodNext(q.Period, q.Start).Add(-time.Hour)
+
+		reports, err = s.GetReports(hourly)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	counts := storage.Counts{}
+	for _, report := range reports {
+		counts.Add(report.Counts)
+	}
+
+	return counts.WithoutDistinct(), nil
+}
+
+// totals sums the event counts of each repository
+func totals(counts storage.Counts) map[string]int {
+	output := map[string]int{}
+	for repo, repoEvents := range counts {
+		for _, count := range repoEvents {
+			output[repo] += count
+		}
+	}
+	return output
+}
+
+// rank returns the first n rankings with a positive value ordered by that
+// value, with ties broken by repository name
+func rank(rankings []ranking, n int, value func(ranking) int) []ranking {
+	sorted := []ranking{}
+	for _, r := range rankings {
+		if value(r) > 0 {
+			sorted = append(sorted, r)
+		}
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		if value(sorted[i]) != value(sorted[j]) {
+			return value(sorted[i]) > value(sorted[j])
+		}
+		return sorted[i].Repo < sorted[j].Repo
+	})
+
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+// rankings compares the current and previous period totals of every
+// repository active in either period
+func rankings(current, previous map[string]int) []ranking {
+	output := []ranking{}
+	for repo, count := range current {
+		r := ranking{
+			Repo:     repo,
+			Count:    count,
+			Previous: previous[repo],
+			Delta:    count - previous[repo],
+		}
+
+		if r.Previous > 0 {
+			change := float64(r.Delta) / float64(r.Previous) * 100
+			r.Change = &change
+		}
+		output = append(output, r)
+	}
+
+	for repo, count := range previous {
+		if _, ok := current[repo]; !ok {
+			change := -100.0
+			output = append(output, ranking{
+				Repo:     repo,
+				Previous: count,
+				Delta:    -count,
+				Change:   &change,
+			})
+		}
+	}
+
+	return output
+}
+
+func loadTop(req Request, s storage.Storage) (events.APIGatewayProxyResponse, error) {
+	q, n, err := topQuery(req)
+	if err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "error parsing query: " + err.Error(),
+			IsBase64Encoded: false,
+		}, err
+	}
+	log.Printf("top query start: %s, period: %s, report: %s, n: %d, types: %v", q.Start, q.Period, q.Report, n, q.Events)
+
+	current, err := periodCounts(s, q)
+	if err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "error loading reports: " + err.Error(),
+			IsBase64Encoded: false,
+		}, err
+	}
+
+	previousQuery := q
+	previousQuery.Start = storage.PeriodStart(q.Period, q.Start.Add(-time.Hour))
+	previousQuery.End = previousQuery.Start
+
+	previous, err := periodCounts(s, previousQuery)
+	if err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "error loading reports: " + err.Error(),
+			IsBase64Encoded: false,
+		}, err
+	}
+
+	all := rankings(totals(current), totals(previous))
+	topObject := topPage{
+		Period: q.Period,
+		Start:  q.Start,
+		Report: q.Report,
+		Types:  q.Events,
+		Top: rank(all, n, func(r ranking) int {
+			return r.Count
+		}),
+		Growth: rank(all, n, func(r ranking) int {
+			return r.Delta
+		}),
+	}
+
+	output, err := json.Marshal(topObject)
+	if err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "error marshalling output: " + err.Error(),
+			IsBase64Encoded: false,
+		}, err
+	}
+
+	log.Println("load top successful")
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers: map[string]string{
+			"result_count": strconv.Itoa(len(topObject.Top)),
+		},
+		Body:            string(output),
+		IsBase64Encoded: false,
+	}, nil
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/forstmeier/comana/storage"
+)
+
+type topStorage struct {
+	mockStorage
+	reports map[string][]storage.Report
+}
+
+func (t *topStorage) GetReports(q storage.Query) ([]storage.Report, error) {
+	output := []storage.Report{}
+	for _, report := range t.reports[q.Period+"/"+q.Start.Format("2006-01-02")] {
+		report.Counts = report.Counts.Filter(q.Repos, q.Owners, q.Events)
+		output = append(output, report)
+	}
+	return output, nil
+}
+
+func Test_topQuery(t *testing.T) {
+	tests := []struct {
+		desc   string
+		query  map[string]string
+		start  time.Time
+		period string
+		n      int
+		err    string
+	}{
+		{
+			desc: "invalid n",
+			query: map[string]string{
+				"n": "0",
+			},
+			err: "invalid n: 0",
+		},
+		{
+			desc: "invalid period",
+			query: map[string]string{
+				"period": "hour",
+			},
+			err: "invalid period: hour",
+		},
+		{
+			desc: "week containing start",
+			query: map[string]string{
+				"period": "week",
+				"start":  "1977-05-25T10",
+				"n":      "3",
+			},
+			start:  time.Date(1977, 5, 23, 0, 0, 0, 0, time.UTC),
+			period: "week",
+			n:      3,
+		},
+	}
+
+	for _, test := range tests {
+		q, n, err := topQuery(Request{
+			QueryStringParameters: test.query,
+		})
+
+		if err != nil {
+			if err.Error() != test.err {
+				t.Errorf("description: %s, error received: %s, expected: %s", test.desc, err.Error(), test.err)
+			}
+			continue
+		}
+
+		if !q.Start.Equal(test.start) || !q.End.Equal(test.start) || q.Period != test.period || n != test.n {
+			t.Errorf("description: %s, output received: %+v %d, expected: %s %s %d", test.desc, q, n, test.start, test.period, test.n)
+		}
+	}
+}
+
+func Test_rankings(t *testing.T) {
+	current := map[string]int{"luke/x-wing": 10, "han/falcon": 4, "leia/tantive": 4}
+	previous := map[string]int{"luke/x-wing": 5, "han/falcon": 8, "lando/cloud-city": 2}
+
+	all := rankings(current, previous)
+	count := func(r ranking) int {
+		return r.Count
+	}
+	delta := func(r ranking) int {
+		return r.Delta
+	}
+
+	top := []string{}
+	for _, r := range rank(all, 2, count) {
+		top = append(top, r.Repo)
+	}
+	if expected := []string{"luke/x-wing", "han/falcon"}; !reflect.DeepEqual(top, expected) {
+		t.Errorf("description: top by count, output received: %v, expected: %v", top, expected)
+	}
+
+	growth := rank(all, 10, delta)
+	if len(growth) != 2 || growth[0].Repo != "luke/x-wing" || growth[0].Delta != 5 || *growth[0].Change != 100 || growth[1].Change != nil {
+		t.Errorf("description: top by growth, output received: %+v", growth)
+	}
+}
+
+func Test_periodCounts(t *testing.T) {
+	s := &topStorage{
+		reports: map[string][]storage.Report{
+			"hour/1977-05-25": {
+				{
+					File: storage.File{
+						Counts: storage.Counts{
+							"luke/x-wing": {"WatchEvent": 1, "actors": 5},
+						},
+					},
+				},
+				{
+					File: storage.File{
+						Counts: storage.Counts{
+							"luke/x-wing": {"WatchEvent": 2, "actors": 5},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	output, err := periodCounts(s, storage.Query{
+		Start:  time.Date(1977, 5, 25, 0, 0, 0, 0, time.UTC),
+		Period: storage.Day,
+		Report: defaultReport,
+	})
+	if err != nil {
+		t.Fatalf("description: summed hourly reports, error received: %s", err.Error())
+	}
+
+	expected := storage.Counts{
+		"luke/x-wing": {"WatchEvent": 3},
+	}
+	if !reflect.DeepEqual(output, expected) {
+		t.Errorf("description: summed hourly reports, output received: %+v, expected: %+v", output, expected)
+	}
+}
+
+func TestLoadDataTop(t *testing.T) {
+	s := &topStorage{
+		reports: map[string][]storage.Report{
+			"day/1977-05-25": {
+				{
+					File: storage.File{
+						Counts: storage.Counts{
+							"luke/x-wing": {"WatchEvent": 3, "PushEvent": 9},
+							"han/falcon":  {"WatchEvent": 5},
+						},
+					},
+				},
+			},
+			"hour/1977-05-24": {
+				{
+					File: storage.File{
+						Counts: storage.Counts{
+							"luke/x-wing": {"WatchEvent": 1},
+						},
+					},
+				},
+				{
+					File: storage.File{
+						Counts: storage.Counts{
+							"han/falcon": {"WatchEvent": 5},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	resp, err := LoadData(Request{
+		QueryStringParameters: map[string]string{
+			"mode":  "top",
+			"start": "1977-05-25",
+			"type":  "WatchEvent",
+		},
+	}, s)
+	if err != nil {
+		t.Fatalf("description: top watch events, error received: %s", err.Error())
+	}
+
+	output := topPage{}
+	if err := json.Unmarshal([]byte(resp.Body), &output); err != nil {
+		t.Fatalf("description: top watch events, error decoding body: %s", err.Error())
+	}
+
+	if len(output.Top) != 2 || output.Top[0].Repo != "han/falcon" || output.Top[0].Count != 5 {
+		t.Errorf("description: top watch events, top received: %+v", output.Top)
+	}
+
+	if len(output.Growth) != 1 || output.Growth[0].Repo != "luke/x-wing" || output.Growth[0].Previous != 1 {
+		t.Errorf("description: top watch events, growth received: %+v", output.Growth)
+	}
+
+	resp, err = LoadData(Request{
+		QueryStringParameters: map[string]string{
+			"mode": "bottom",
+		},
+	}, s)
+	if err == nil || err.Error() != "invalid mode: bottom" || resp.StatusCode != 500 {
+		t.Errorf("description: invalid mode, error received: %v, status received: %d", err, resp.StatusCode)
+	}
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/forstmeier/comana/storage"
+	"github.com/forstmeier/comana/watchlist"
+)
+
+func init() {
+	RegisterSaveHook("watchlists", watchlistHook)
+}
+
+// watchRequest is the body of requests modifying a watchlist
+type watchRequest struct {
+	Name   string   `json:"name"`
+	Repos  []string `json:"repos"`
+	Owners []string `json:"owners"`
+}
+
+// watchlistsPage wraps every stored watchlist
+type watchlistsPage struct {
+	Watchlists []watchlist.Watchlist `json:"watchlists"`
+}
+
+// watchlistHook saves a report for each watchlist holding the saved hour's
+// event counts for its watched repositories and owners
+func watchlistHook(s storage.Storage, t time.Time) error {
+	lists, err := watchlist.All(s)
+	if err != nil || len(lists) == 0 {
+		return err
+	}
+
+	reports, err := s.GetReports(storage.Query{
+		Start:  t,
+		End:    t,
+		Period: storage.Hour,
+		Report: defaultReport,
+	})
+	if err != nil {
+		return err
+	}
+
+	file := storage.File{
+		Counts: storage.Counts{},
+	}
+	for _, report := range reports {
+		file.Add(report.File)
+	}
+
+	for _, w := range lists {
+		b, err := json.Marshal(storage.File{
+			Parsed:  file.Parsed,
+			Skipped: file.Skipped,
+			Counts:  w.Filter(file.Counts),
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := s.PutFile(t.Year(), int(t.Month()), t.Day(), t.Hour(), w.Report(), bytes.NewReader(b)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WatchData lists and retrieves watchlists with GET requests, adds the body
+// repositories and owners to a watchlist with POST requests, and removes
+// them, or the whole watchlist when none are provided, with DELETE requests
+func WatchData(req Request, s storage.Storage) (events.APIGatewayProxyResponse, error) {
+	log.Printf("watch request: %s %s", req.HTTPMethod, req.Body)
+
+	var output interface{}
+	var err error
+
+	switch req.HTTPMethod {
+	case "", "GET":
+		output, err = getWatchlists(req, s)
+	case "POST", "DELETE":
+		if err = CheckSecret(req); err == nil {
+			output, err = updateWatchlist(req, s)
+		}
+	default:
+		err = errors.New("unsupported method: " + req.HTTPMethod)
+	}
+
+	if err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "error handling watchlist: " + err.Error(),
+			IsBase64Encoded: false,
+		}, err
+	}
+
+	body, err := json.Marshal(output)
+	if err != nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode:      500,
+			Body:            "error marshalling output: " + err.Error(),
+			IsBase64Encoded: false,
+		}, err
+	}
+
+	log.Println("watch successful")
+	return events.APIGatewayProxyResponse{
+		StatusCode:      200,
+		Body:            string(body),
+		IsBase64Encoded: false,
+	}, nil
+}
+
+func getWatchlists(req Request, s storage.Storage) (interface{}, error) {
+	if name := req.param("name"); name != "" {
+		if !watchlist.ValidName(name) {
+			return nil, errors.New("invalid watchlist name: " + name)
+		}
+		return watchlist.Get(s, name)
+	}
+
+	lists, err := watchlist.All(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return watchlistsPage{
+		Watchlists: lists,
+	}, nil
+}
+
+func updateWatchlist(req Request, s storage.Storage) (interface{}, error) {
+	body := watchRequest{}
+	if err := json.Unmarshal([]byte(req.Body), &body); err != nil {
+		return nil, errors.New("invalid body: " + err.Error())
+	}
+
+	if !watchlist.ValidName(body.Name) {
+		return nil, errors.New("invalid watchlist name: " + body.Name)
+	}
+
+	w, err := watchlist.Get(s, body.Name)
+	if err == watchlist.ErrNotFound && req.HTTPMethod == "POST" {
+		w, err = watchlist.Watchlist{Name: body.Name}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if req.HTTPMethod == "DELETE" {
+		if len(body.Repos) == 0 && len(body.Owners) == 0 {
+			return w, watchlist.Delete(s, w.Name)
+		}
+		w.Remove(body.Repos, body.Owners)
+	} else {
+		w.Add(body.Repos, body.Owners)
+	}
+
+	return w, watchlist.Put(s, w)
+}
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/forstmeier/comana/alert"
+	"github.com/forstmeier/comana/storage"
+	"github.com/forstmeier/comana/watchlist"
+)
+
+func Test_watchlistHook(t *testing.T) {
+	s := storage.NewMemory("")
+	if err := s.PutFile(1977, 5, 25, 20, defaultReport, strings.NewReader(`{"parsed":3,"counts":{"luke/x-wing":{"PushEvent":1},"han/falcon":{"ForkEvent":1},"empire/death-star":{"PushEvent":1}}}`)); err != nil {
+		t.Fatalf("description: put file, error received: %s", err.Error())
+	}
+
+	if err := watchlistHook(s, time.Date(1977, 5, 25, 20, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("description: no watchlists, error received: %s", err.Error())
+	}
+
+	if err := watchlist.Put(s, watchlist.Watchlist{Name: "rebels", Repos: []string{"luke/x-wing"}, Owners: []string{"han"}}); err != nil {
+		t.Fatalf("description: put watchlist, error received: %s", err.Error())
+	}
+
+	now := time.Date(1977, 5, 25, 20, 0, 0, 0, time.UTC)
+	if err := watchlistHook(s, now); err != nil {
+		t.Fatalf("description: watchlist report, error received: %s", err.Error())
+	}
+
+	reports, err := s.GetReports(storage.Query{
+		Start:  now,
+		End:    now,
+		Report: "watchlist-rebels",
+	})
+	if err != nil {
+		t.Fatalf("description: watchlist report, error received: %s", err.Error())
+	}
+
+	if len(reports) != 1 || reports[0].Parsed != 3 || len(reports[0].Counts) != 2 || reports[0].Counts["han/falcon"]["ForkEvent"] != 1 {
+		t.Errorf("description: watchlist report, output received: %+v", reports)
+	}
+}
+
+func TestWatchData(t *testing.T) {
+	os.Setenv("COMANA_SECRET", "test-secret")
+	s := storage.NewMemory("")
+
+	tests := []struct {
+		desc   string
+		method string
+		secret string
+		name   string
+		body   string
+		status int
+		output string
+	}{
+		{
+			desc:   "incorrect secret",
+			method: "POST",
+			secret: "wrong-secret",
+			body:   `{"name":"rebels","repos":["luke/x-wing"]}`,
+			status: 500,
+			output: "error handling watchlist: incorrect secret received: wrong-secret",
+		},
+		{
+			desc:   "invalid name",
+			method: "POST",
+			secret: "test-secret",
+			body:   `{"name":"Rebel Alliance"}`,
+			status: 500,
+			output: "error handling watchlist: invalid watchlist name: Rebel Alliance",
+		},
+		{
+			desc:   "add entities",
+			method: "POST",
+			secret: "test-secret",
+			body:   `{"name":"rebels","repos":["luke/x-wing","han/falcon"],"owners":["alliance"]}`,
+			status: 200,
+			output: `{"name":"rebels","repos":["han/falcon","luke/x-wing"],"owners":["alliance"]}`,
+		},
+		{
+			desc:   "remove entities",
+			method: "DELETE",
+			secret: "test-secret",
+			body:   `{"name":"rebels","repos":["han/falcon"]}`,
+			status: 200,
+			output: `{"name":"rebels","repos":["luke/x-wing"],"owners":["alliance"]}`,
+		},
+		{
+			desc:   "get watchlist",
+			method: "GET",
+			name:   "rebels",
+			status: 200,
+			output: `{"name":"rebels","repos":["luke/x-wing"],"owners":["alliance"]}`,
+		},
+		{
+			desc:   "get invalid name",
+			method: "GET",
+			name:   "../subscriptions",
+			status: 500,
+			output: "error handling watchlist: invalid watchlist name: ../subscriptions",
+		},
+		{
+			desc:   "list watchlists",
+			method: "GET",
+			status: 200,
+			output: `{"watchlists":[{"name":"rebels","repos":["luke/x-wing"],"owners":["alliance"]}]}`,
+		},
+		{
+			desc:   "delete watchlist",
+			method: "DELETE",
+			secret: "test-secret",
+			body:   `{"name":"rebels"}`,
+			status: 200,
+			output: `{"name":"rebels","repos":["luke/x-wing"],"owners":["alliance"]}`,
+		},
+		{
+			desc:   "get deleted watchlist",
+			method: "GET",
+			name:   "rebels",
+			status: 500,
+			output: "error handling watchlist: watchlist not found",
+		},
+		{
+			desc:   "unsupported method",
+			method: "PATCH",
+			status: 500,
+			output: "error handling watchlist: unsupported method: PATCH",
+		},
+	}
+
+	for _, test := range tests {
+		req := Request{
+			HTTPMethod: test.method,
+			Body:       test.body,
+			Headers: map[string]string{
+				"COMANA_SECRET": test.secret,
+			},
+			QueryStringParameters: map[string]string{
+				"name": test.name,
+			},
+		}
+
+		resp, _ := WatchData(req, s)
+
+		if resp.StatusCode != test.status {
+			t.Errorf("description: %s, status received: %d, expected: %d", test.desc, resp.StatusCode, test.status)
+		}
+
+		if resp.Body != test.output {
+			t.Errorf("description: %s, body received: %s, expected: %s", test.desc, resp.Body, test.output)
+		}
+	}
+}
+
+func TestWatchlistAlertHook(t *testing.T) {
+	s := storage.NewMemory("")
+	now := time.Date(1977, 5, 25, 20, 0, 0, 0, time.UTC)
+	for i := 24; i >= 0; i-- {
+		hour := now.Add(-time.Duration(i) * time.Hour)
+		count := 2
+		if i == 0 {
+			count = 90
+		}
+
+		b, _ := json.Marshal(storage.File{
+			Counts: storage.Counts{
+				"luke/x-wing":       {"WatchEvent": count},
+				"empire/death-star": {"WatchEvent": count},
+			},
+		})
+		if err := s.PutFile(hour.Year(), int(hour.Month()), hour.Day(), hour.Hour(), defaultReport, strings.NewReader(string(b))); err != nil {
+			t.Fatalf("description: put file, error received: %s", err.Error())
+		}
+
+		b, _ = json.Marshal(storage.File{
+			Counts: storage.Counts{
+				"luke":   {"WatchEvent": count},
+				"empire": {"WatchEvent": count},
+			},
+		})
+		if err := s.PutFile(hour.Year(), int(hour.Month()), hour.Day(), hour.Hour(), ownerReport, strings.NewReader(string(b))); err != nil {
+			t.Fatalf("description: put file, error received: %s", err.Error())
+		}
+	}
+
+	n := &notifierMock{}
+	if err := WatchlistAlertHook(alert.NewDetector(), n, "rebels")(s, now); err != watchlist.ErrNotFound {
+		t.Errorf("description: missing watchlist, error received: %v, expected: %s", err, watchlist.ErrNotFound)
+	}
+
+	if err := watchlist.Put(s, watchlist.Watchlist{Name: "rebels", Owners: []string{"luke"}}); err != nil {
+		t.Fatalf("description: put watchlist, error received: %s", err.Error())
+	}
+
+	if err := WatchlistAlertHook(alert.NewDetector(), n, "rebels")(s, now); err != nil {
+		t.Fatalf("description: watched owner, error received: %s", err.Error())
+	}
+
+	if len(n.alerts) != 1 || n.alerts[0].Repo != "luke" {
+		t.Errorf("description: watched owner, alerts received: %+v", n.alerts)
+	}
+
+	if err := watchlist.Put(s, watchlist.Watchlist{Name: "rebels", Repos: []string{"empire/death-star"}, Owners: []string{"luke"}}); err != nil {
+		t.Fatalf("description: put watchlist, error received: %s", err.Error())
+	}
+
+	n = &notifierMock{}
+	if err := WatchlistAlertHook(alert.NewDetector(), n, "rebels")(s, now); err != nil {
+		t.Fatalf("description: watched owner and repo, error received: %s", err.Error())
+	}
+
+	if len(n.alerts) != 2 || n.alerts[0].Repo != "empire/death-star" || n.alerts[1].Repo != "luke" {
+		t.Errorf("description: watched owner and repo, alerts received: %+v", n.alerts)
+	}
+}
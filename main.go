@@ -2,28 +2,57 @@ package main
 
 import (
 	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 
+	"github.com/forstmeier/comana/alert"
 	"github.com/forstmeier/comana/handlers"
+	"github.com/forstmeier/comana/server"
 	"github.com/forstmeier/comana/storage"
 )
 
 // HANDLER allows for build-time starter configuration
 var HANDLER string
 
+// store is the storage backend selected by the COMANA_STORAGE and
+// COMANA_STORAGE_LOCATION environment variables
+var store storage.Storage
+
+// invoker triggers saves for backfills as selected by the COMANA_INVOKE and
+// COMANA_INVOKE_TARGET environment variables
+var invoker handlers.Invoker
+
 func starter(req handlers.Request) (events.APIGatewayProxyResponse, error) {
-	s := storage.New()
+	s := store
 
 	switch HANDLER {
 	case "SAVE":
 		return handlers.SaveData(req, s)
 	case "LOAD":
-		return handlers.LoadData(s)
+		return handlers.LoadData(req, s)
+	case "MERGE":
+		return handlers.MergeData(req, s)
+	case "SERIES":
+		return handlers.SeriesData(req, s)
+	case "INDEX":
+		return handlers.IndexData(req, s)
+	case "WATCH":
+		return handlers.WatchData(req, s)
+	case "SUBSCRIBE":
+		return handlers.SubscribeData(req, s)
+	case "ROLLUP":
+		return handlers.RollupData(req, s)
 	case "BACKFILL":
-		i := handlers.NewInvoke()
-		return handlers.BackfillData(req, i)
+		return handlers.BackfillData(req, invoker, s)
+	case "JOB":
+		return handlers.JobData(req, s)
+	case "RECONCILE":
+		return handlers.ReconcileData(req, invoker, s)
 	}
 
 	return events.APIGatewayProxyResponse{
@@ -33,6 +62,73 @@ func starter(req handlers.Request) (events.APIGatewayProxyResponse, error) {
 	}, errors.New("requested lambda type not available")
 }
 
+// configureAlerts registers the alert save hook when a notifier is selected
+// by the COMANA_ALERTS and COMANA_ALERT_TARGET environment variables, with
+// COMANA_ALERT_WATCHLIST or COMANA_ALERT_REPOS required to select the
+// watched repositories
+func configureAlerts() error {
+	kind := os.Getenv("COMANA_ALERTS")
+	if kind == "" {
+		return nil
+	}
+
+	n, err := alert.NewFromConfig(kind, os.Getenv("COMANA_ALERT_TARGET"))
+	if err != nil {
+		return err
+	}
+
+	if name := os.Getenv("COMANA_ALERT_WATCHLIST"); name != "" {
+		handlers.RegisterSaveHook("alerts", handlers.WatchlistAlertHook(alert.NewDetector(), n, name))
+		return nil
+	}
+
+	repos := []string{}
+	for _, repo := range strings.Split(os.Getenv("COMANA_ALERT_REPOS"), ",") {
+		if repo = strings.TrimSpace(repo); repo != "" {
+			repos = append(repos, repo)
+		}
+	}
+
+	if len(repos) == 0 {
+		return errors.New("COMANA_ALERT_REPOS or COMANA_ALERT_WATCHLIST is required")
+	}
+
+	handlers.RegisterSaveHook("alerts", handlers.AlertHook(alert.NewDetector(), n, repos))
+	return nil
+}
+
 func main() {
+	s, err := storage.NewFromConfig(os.Getenv("COMANA_STORAGE"), os.Getenv("COMANA_STORAGE_LOCATION"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	store = s
+
+	i, err := handlers.NewInvokeFromConfig(os.Getenv("COMANA_INVOKE"), os.Getenv("COMANA_INVOKE_TARGET"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	invoker = i
+
+	if err := configureAlerts(); err != nil {
+		log.Fatal(err)
+	}
+
+	if HANDLER == "SERVER" {
+		address := os.Getenv("COMANA_ADDRESS")
+		if address == "" {
+			address = ":8080"
+		}
+
+		log.Printf("serving on %s", address)
+		log.Fatal(http.ListenAndServe(address, server.New(store, handlers.NewLocalInvoke(store))))
+	}
+
+	if HANDLER == "WORK" {
+		lambda.Start(func(req handlers.Request) (handlers.BatchResponse, error) {
+			return handlers.WorkData(req, store)
+		})
+	}
+
 	lambda.Start(starter)
 }
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/forstmeier/comana/handlers"
+	"github.com/forstmeier/comana/storage"
+)
+
+// Handler matches the signature shared by the Lambda handlers
+type Handler func(handlers.Request) (events.APIGatewayProxyResponse, error)
+
+// convert builds a handler request from an HTTP request; JSON bodies are
+// also decoded into the request so that the hour or day of save, rollup,
+// and index requests can be posted as they would be delivered to the
+// Lambda, but the event source and SQS records are never taken from them
+func convert(r *http.Request) (handlers.Request, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return handlers.Request{}, err
+	}
+
+	req := handlers.Request{}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			req = handlers.Request{}
+		}
+	}
+
+	req.Source, req.Records = "", nil
+	req.Body = string(body)
+	req.HTTPMethod = r.Method
+
+	req.Headers = map[string]string{}
+	for key := range r.Header {
+		req.Headers[key] = r.Header.Get(key)
+	}
+
+	req.QueryStringParameters = map[string]string{}
+	req.MultiValueQueryStringParameters = map[string][]string{}
+	for key, values := range r.URL.Query() {
+		req.QueryStringParameters[key] = values[0]
+		req.MultiValueQueryStringParameters[key] = values
+	}
+
+	return req, nil
+}
+
+// Adapt exposes a Lambda handler as an http.Handler
+func Adapt(h Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, err := convert(r)
+		if err != nil {
+			http.Error(w, "error reading request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resp, err := h(req)
+		if err != nil {
+			log.Printf("%s %s error: %s", r.Method, r.URL.Path, err.Error())
+		}
+
+		for key, value := range resp.Headers {
+			w.Header().Set(key, value)
+		}
+
+		status := resp.StatusCode
+		if status == 0 {
+			status = http.StatusInternalServerError
+		}
+
+		w.WriteHeader(status)
+		w.Write([]byte(resp.Body))
+	})
+}
+
+// secured wraps a handler for routes which start jobs or modify stored
+// data, rejecting requests without the COMANA_SECRET header and setting the
+// event source the handler accepts from these requests
+func secured(source string, h Handler) Handler {
+	return func(req handlers.Request) (events.APIGatewayProxyResponse, error) {
+		if err := handlers.CheckSecret(req); err != nil {
+			return events.APIGatewayProxyResponse{
+				StatusCode:      500,
+				Body:            err.Error(),
+				IsBase64Encoded: false,
+			}, err
+		}
+
+		req.Source = source
+		return h(req)
+	}
+}
+
+// New generates an http.Handler routing to the Lambda handlers; storage
+// backends which are themselves http.Handlers are served under /files/
+func New(s storage.Storage, i handlers.Invoker) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.Handle("/load", Adapt(func(req handlers.Request) (events.APIGatewayProxyResponse, error) {
+		return handlers.LoadData(req, s)
+	}))
+
+	mux.Handle("/merge", Adapt(func(req handlers.Request) (events.APIGatewayProxyResponse, error) {
+		return handlers.MergeData(req, s)
+	}))
+
+	mux.Handle("/series", Adapt(func(req handlers.Request) (events.APIGatewayProxyResponse, error) {
+		return handlers.SeriesData(req, s)
+	}))
+
+	mux.Handle("/save", Adapt(secured("comana.backfill", func(req handlers.Request) (events.APIGatewayProxyResponse, error) {
+		return handlers.SaveData(req, s)
+	})))
+
+	mux.Handle("/rollup", Adapt(secured("comana.rollup", func(req handlers.Request) (events.APIGatewayProxyResponse, error) {
+		return handlers.RollupData(req, s)
+	})))
+
+	mux.Handle("/index", Adapt(secured("comana.index", func(req handlers.Request) (events.APIGatewayProxyResponse, error) {
+		return handlers.IndexData(req, s)
+	})))
+
+	mux.Handle("/watch", Adapt(func(req handlers.Request) (events.APIGatewayProxyResponse, error) {
+		return handlers.WatchData(req, s)
+	}))
+
+	mux.Handle("/subscribe", Adapt(func(req handlers.Request) (events.APIGatewayProxyResponse, error) {
+		return handlers.SubscribeData(req, s)
+	}))
+
+	mux.Handle("/backfill", Adapt(func(req handlers.Request) (events.APIGatewayProxyResponse, error) {
+		return handlers.BackfillData(req, i, s)
+	}))
+
+	mux.Handle("/jobs", Adapt(func(req handlers.Request) (events.APIGatewayProxyResponse, error) {
+		return handlers.JobData(req, s)
+	}))
+
+	mux.Handle("/reconcile", Adapt(func(req handlers.Request) (events.APIGatewayProxyResponse, error) {
+		return handlers.ReconcileData(req, i, s)
+	}))
+
+	if files, ok := s.(http.Handler); ok {
+		mux.Handle("/files/", http.StripPrefix("/files", files))
+	}
+
+	return mux
+}
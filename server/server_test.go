@@ -0,0 +1,231 @@
+package server
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/forstmeier/comana/handlers"
+	"github.com/forstmeier/comana/storage"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(ioutil.Discard)
+	os.Exit(m.Run())
+}
+
+func Test_convert(t *testing.T) {
+	r := httptest.NewRequest("POST", "/save?repo=luke/x-wing&repo=han/falcon", strings.NewReader(`{"source": "comana.backfill", "year": 1977}`))
+	r.Header.Set("COMANA_SECRET", "test-secret")
+
+	req, err := convert(r)
+	if err != nil {
+		t.Fatalf("description: convert request, error received: %s", err.Error())
+	}
+
+	if req.Source != "" || req.Year != 1977 {
+		t.Errorf("description: convert request, event fields received: %s %d", req.Source, req.Year)
+	}
+
+	if req.HTTPMethod != "POST" || req.Body == "" {
+		t.Errorf("description: convert request, request fields received: %s %s", req.HTTPMethod, req.Body)
+	}
+
+	if len(req.MultiValueQueryStringParameters["repo"]) != 2 {
+		t.Errorf("description: convert request, parameters received: %v", req.MultiValueQueryStringParameters)
+	}
+
+	if req.Headers["Comana_secret"] != "test-secret" {
+		t.Errorf("description: convert request, headers received: %v", req.Headers)
+	}
+}
+
+func TestAdapt(t *testing.T) {
+	tests := []struct {
+		desc   string
+		resp   events.APIGatewayProxyResponse
+		err    error
+		status int
+		body   string
+	}{
+		{
+			desc: "handler error",
+			resp: events.APIGatewayProxyResponse{
+				StatusCode: 500,
+				Body:       "handler error",
+			},
+			err:    errors.New("handler error"),
+			status: 500,
+			body:   "handler error",
+		},
+		{
+			desc: "successful invocation",
+			resp: events.APIGatewayProxyResponse{
+				StatusCode: 200,
+				Headers: map[string]string{
+					"result_count": "0",
+				},
+				Body: "success",
+			},
+			err:    nil,
+			status: 200,
+			body:   "success",
+		},
+	}
+
+	for _, test := range tests {
+		h := Adapt(func(handlers.Request) (events.APIGatewayProxyResponse, error) {
+			return test.resp, test.err
+		})
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+		if w.Code != test.status {
+			t.Errorf("description: %s, status received: %d, expected: %d", test.desc, w.Code, test.status)
+		}
+
+		if w.Body.String() != test.body {
+			t.Errorf("description: %s, body received: %s, expected: %s", test.desc, w.Body.String(), test.body)
+		}
+
+		for key, value := range test.resp.Headers {
+			if w.Header().Get(key) != value {
+				t.Errorf("description: %s, header %s received: %s, expected: %s", test.desc, key, w.Header().Get(key), value)
+			}
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	s := storage.NewMemory("")
+	server := httptest.NewServer(New(s, handlers.NewLocalInvoke(s)))
+	defer server.Close()
+
+	if err := s.PutFile(1977, 5, 25, 20, "per-repo-count", strings.NewReader(`{"luke/x-wing":{"PushEvent":1}}`)); err != nil {
+		t.Fatalf("error creating test report: %s", err.Error())
+	}
+
+	tests := []struct {
+		desc   string
+		method string
+		path   string
+		body   string
+		secret string
+		status int
+	}{
+		{
+			desc:   "load reports",
+			method: "GET",
+			path:   "/load?start=1977-05-25T00&end=1977-05-25T23&owner=luke",
+			body:   "",
+			status: 200,
+		},
+		{
+			desc:   "merge reports",
+			method: "GET",
+			path:   "/merge?start=1977-05-25T00&end=1977-05-25T23&repo=luke/x-wing",
+			body:   "",
+			status: 200,
+		},
+		{
+			desc:   "series missing repo",
+			method: "GET",
+			path:   "/series",
+			body:   "",
+			status: 500,
+		},
+		{
+			desc:   "save incorrect secret",
+			method: "POST",
+			path:   "/save",
+			body:   `{"source": "comana.backfill", "year": 1977, "month": 5, "day": 25, "hour": 20}`,
+			secret: "test-secret-failure",
+			status: 500,
+		},
+		{
+			desc:   "rollup incorrect secret",
+			method: "POST",
+			path:   "/rollup",
+			body:   `{"year": 1977, "month": 5, "day": 25}`,
+			status: 500,
+		},
+		{
+			desc:   "rollup day",
+			method: "POST",
+			path:   "/rollup",
+			body:   `{"source": "aws.events", "year": 1977, "month": 5, "day": 25}`,
+			secret: "test-secret",
+			status: 200,
+		},
+		{
+			desc:   "index incorrect secret",
+			method: "POST",
+			path:   "/index",
+			body:   `{"year": 1977, "month": 5, "day": 25}`,
+			status: 500,
+		},
+		{
+			desc:   "backfill incorrect secret",
+			method: "POST",
+			path:   "/backfill",
+			body:   `{}`,
+			status: 500,
+		},
+		{
+			desc:   "reconcile fill incorrect secret",
+			method: "POST",
+			path:   "/reconcile",
+			body:   `{"fill": true}`,
+			status: 500,
+		},
+		{
+			desc:   "stored file",
+			method: "GET",
+			path:   "/files/1977/05/25/20/count/per-repo-count.json",
+			body:   "",
+			status: 200,
+		},
+		{
+			desc:   "stored non-report object",
+			method: "GET",
+			path:   "/files/day/1977/05/25/per-repo-count.json",
+			body:   "",
+			status: 404,
+		},
+		{
+			desc:   "unknown route",
+			method: "GET",
+			path:   "/unknown",
+			body:   "",
+			status: 404,
+		},
+	}
+
+	os.Setenv("COMANA_SECRET", "test-secret")
+
+	for _, test := range tests {
+		req, err := http.NewRequest(test.method, server.URL+test.path, strings.NewReader(test.body))
+		if err != nil {
+			t.Fatalf("description: %s, error creating request: %s", test.desc, err.Error())
+		}
+		req.Header.Set("COMANA_SECRET", test.secret)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("description: %s, error received: %s", test.desc, err.Error())
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != test.status {
+			t.Errorf("description: %s, status received: %d, expected: %d", test.desc, resp.StatusCode, test.status)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// Package stats provides trend statistics and forecasts for activity series
+package stats
+
+import (
+	"errors"
+	"math"
+)
+
+// MovingAverage returns the trailing average of each value over the window;
+// values before the window is full are averaged over those available
+func MovingAverage(values []float64, window int) []float64 {
+	if window < 1 {
+		window = 1
+	}
+
+	output := make([]float64, len(values))
+	sum := 0.0
+	for i, value := range values {
+		sum += value
+		if i >= window {
+			sum -= values[i-window]
+		}
+
+		size := window
+		if i+1 < window {
+			size = i + 1
+		}
+		output[i] = sum / float64(size)
+	}
+
+	return output
+}
+
+// Deltas returns the difference between each value and the value lag
+// positions before it; values without a predecessor are nil
+func Deltas(values []float64, lag int) []*float64 {
+	output := make([]*float64, len(values))
+	for i := lag; i < len(values) && lag > 0; i++ {
+		delta := values[i] - values[i-lag]
+		output[i] = &delta
+	}
+	return output
+}
+
+// PercentChanges returns the percentage change of each value from the
+// value lag positions before it; values without a predecessor or with a
+// zero predecessor are nil
+func PercentChanges(values []float64, lag int) []*float64 {
+	output := make([]*float64, len(values))
+	for i := lag; i < len(values) && lag > 0; i++ {
+		if values[i-lag] == 0 {
+			continue
+		}
+
+		change := (values[i] - values[i-lag]) / values[i-lag] * 100
+		output[i] = &change
+	}
+	return output
+}
+
+// Holt holds the fitted parameters and final state of Holt's linear
+// exponential smoothing
+type Holt struct {
+	Alpha float64 `json:"alpha"`
+	Beta  float64 `json:"beta"`
+	Level float64 `json:"level"`
+	Trend float64 `json:"trend"`
+	SSE   float64 `json:"sse"`
+}
+
+// smooth runs Holt's linear method over the values with the provided
+// smoothing parameters, returning the final state and the sum of squared
+// one step ahead forecast errors
+func smooth(values []float64, alpha, beta float64) Holt {
+	h := Holt{
+		Alpha: alpha,
+		Beta:  beta,
+		Level: values[0],
+		Trend: values[1] - values[0],
+	}
+
+	for _, value := range values[1:] {
+		forecast := h.Level + h.Trend
+		h.SSE += (value - forecast) * (value - forecast)
+
+		level := alpha*value + (1-alpha)*forecast
+		h.Trend = beta*(level-h.Level) + (1-beta)*h.Trend
+		h.Level = level
+	}
+
+	return h
+}
+
+// FitHolt fits Holt's linear method to the values by searching the
+// smoothing parameters for the smallest one step ahead squared error
+func FitHolt(values []float64) (Holt, error) {
+	if len(values) < 2 {
+		return Holt{}, errors.New("at least two values are required to fit a forecast")
+	}
+
+	best := Holt{
+		SSE: math.Inf(1),
+	}
+	for a := 1; a < 20; a++ {
+		for b := 1; b < 20; b++ {
+			if h := smooth(values, float64(a)/20, float64(b)/20); h.SSE < best.SSE {
+				best = h
+			}
+		}
+	}
+
+	return best, nil
+}
+
+// Forecast returns the projected values for the periods following the
+// fitted series
+func (h Holt) Forecast(periods int) []float64 {
+	output := []float64{}
+	for i := 1; i <= periods; i++ {
+		output = append(output, h.Level+float64(i)*h.Trend)
+	}
+	return output
+}
@@ -0,0 +1,89 @@
+package stats
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func values(pointers []*float64) []interface{} {
+	output := []interface{}{}
+	for _, p := range pointers {
+		if p == nil {
+			output = append(output, nil)
+		} else {
+			output = append(output, *p)
+		}
+	}
+	return output
+}
+
+func TestMovingAverage(t *testing.T) {
+	tests := []struct {
+		desc     string
+		values   []float64
+		window   int
+		expected []float64
+	}{
+		{
+			desc:     "partial leading window",
+			values:   []float64{2, 4, 6, 8},
+			window:   2,
+			expected: []float64{2, 3, 5, 7},
+		},
+		{
+			desc:     "window larger than series",
+			values:   []float64{3, 6},
+			window:   7,
+			expected: []float64{3, 4.5},
+		},
+		{
+			desc:     "empty series",
+			values:   []float64{},
+			window:   3,
+			expected: []float64{},
+		},
+	}
+
+	for _, test := range tests {
+		if output := MovingAverage(test.values, test.window); !reflect.DeepEqual(output, test.expected) {
+			t.Errorf("description: %s, output received: %v, expected: %v", test.desc, output, test.expected)
+		}
+	}
+}
+
+func TestDeltasAndPercentChanges(t *testing.T) {
+	series := []float64{4, 0, 6, 3}
+
+	deltas := values(Deltas(series, 2))
+	if expected := []interface{}{nil, nil, 2.0, 3.0}; !reflect.DeepEqual(deltas, expected) {
+		t.Errorf("description: deltas, output received: %v, expected: %v", deltas, expected)
+	}
+
+	changes := values(PercentChanges(series, 2))
+	if expected := []interface{}{nil, nil, 50.0, nil}; !reflect.DeepEqual(changes, expected) {
+		t.Errorf("description: percent changes, output received: %v, expected: %v", changes, expected)
+	}
+}
+
+func TestFitHolt(t *testing.T) {
+	if _, err := FitHolt([]float64{1}); err == nil {
+		t.Errorf("description: single value, error received: nil, expected: at least two values are required to fit a forecast")
+	}
+
+	h, err := FitHolt([]float64{10, 12, 14, 16, 18, 20})
+	if err != nil {
+		t.Fatalf("description: linear series, error received: %s", err.Error())
+	}
+
+	if h.SSE > 1e-9 || h.Alpha <= 0 || h.Alpha >= 1 || h.Beta <= 0 || h.Beta >= 1 {
+		t.Errorf("description: linear series, model received: %+v", h)
+	}
+
+	forecast := h.Forecast(3)
+	for i, expected := range []float64{22, 24, 26} {
+		if math.Abs(forecast[i]-expected) > 1e-9 {
+			t.Errorf("description: linear series, forecast received: %v, expected: %v", forecast[i], expected)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Filesystem implements Storage on a local directory using the same key
+// layout as the S3 bucket
+type Filesystem struct {
+	root string
+}
+
+// NewFilesystem generates a filesystem implementation rooted at the directory
+func NewFilesystem(root string) *Filesystem {
+	return &Filesystem{
+		root: root,
+	}
+}
+
+func (f *Filesystem) path(key string) string {
+	return filepath.Join(f.root, filepath.FromSlash(key))
+}
+
+// PutObject persists a file on disk under the key, replacing any previous version
+func (f *Filesystem) PutObject(key string, file io.Reader) error {
+	path := f.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error putting file: %s", err.Error())
+	}
+
+	output, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error putting file: %s", err.Error())
+	}
+	defer output.Close()
+
+	if _, err := io.Copy(output, file); err != nil {
+		return fmt.Errorf("error putting file: %s", err.Error())
+	}
+
+	return nil
+}
+
+// GetObject retrieves the file stored on disk under the key
+func (f *Filesystem) GetObject(key string) (io.Reader, error) {
+	file, err := os.Open(f.path(key))
+	if err != nil {
+		return nil, fmt.Errorf("error getting object %s: %s", key, err.Error())
+	}
+
+	return file, nil
+}
+
+// ListKeys retrieves the sorted keys of all files stored on disk beginning
+// with the prefix
+func (f *Filesystem) ListKeys(prefix string) ([]string, error) {
+	// only walk the directory containing the prefix rather than the full tree
+	dir := f.root
+	if prefix != "" {
+		dir = f.path(prefix)
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			dir = filepath.Dir(dir)
+		}
+	}
+
+	keys := []string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(f.root, path)
+		if err != nil {
+			return err
+		}
+
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing %s files: %s", prefix, err.Error())
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// DeleteObject removes the file stored on disk under the key
+func (f *Filesystem) DeleteObject(key string) error {
+	if err := os.Remove(f.path(key)); err != nil {
+		return fmt.Errorf("error deleting object %s: %s", key, err.Error())
+	}
+
+	return nil
+}
+
+// PutFile persists a JSON file on disk
+func (f *Filesystem) PutFile(year, month, day, hour int, suffix string, file io.Reader) error {
+	key := hourKey(time.Date(year, time.Month(month), day, hour, 0, 0, 0, time.UTC), suffix)
+	return f.PutObject(key, file)
+}
+
+// PutRollup persists a JSON report file covering the day, week, or month
+// beginning at the provided time on disk, replacing any previous version
+func (f *Filesystem) PutRollup(period string, t time.Time, suffix string, file io.Reader) error {
+	key, err := rollupKey(period, t, suffix)
+	if err != nil {
+		return err
+	}
+
+	return f.PutObject(key, file)
+}
+
+// GetReports retrieves filtered report data stored on disk
+func (f *Filesystem) GetReports(q Query) ([]Report, error) {
+	period, start, err := reportWindow(q)
+	if err != nil {
+		return nil, err
+	}
+
+	if period == Hour && len(q.Repos) > 0 {
+		return indexedReports(f, q)
+	}
+
+	keys := []string{}
+	for _, prefix := range prefixes(period, start, q.End) {
+		prefixKeys, err := f.ListKeys(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("error listing files: %s", err.Error())
+		}
+		keys = append(keys, prefixKeys...)
+	}
+
+	return collectReports(keys, q, f.GetObject)
+}
+
+// GetPaths retrieves file URLs for hourly reports stored on disk over the
+// rolling 12 month window, oldest first
+func (f *Filesystem) GetPaths() ([]string, error) {
+	root, err := filepath.Abs(f.root)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving root: %s", err.Error())
+	}
+
+	paths := []string{}
+	for _, prefix := range pathPrefixes(time.Now()) {
+		keys, err := f.ListKeys(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("error listing files: %s", err.Error())
+		}
+
+		for _, key := range hourKeys(keys) {
+			paths = append(paths, "file://"+filepath.ToSlash(filepath.Join(root, filepath.FromSlash(key))))
+		}
+	}
+
+	return paths, nil
+}
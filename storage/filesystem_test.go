@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFilesystem(t *testing.T) {
+	root, err := ioutil.TempDir("", "comana")
+	if err != nil {
+		t.Fatalf("error creating test directory: %s", err.Error())
+	}
+	defer os.RemoveAll(root)
+
+	f := NewFilesystem(root)
+	now := time.Now().UTC().Add(-time.Hour)
+	year, month, day, hour := now.Year(), int(now.Month()), now.Day(), now.Hour()
+
+	if err := f.PutFile(year, month, day, hour, "per-repo-count", strings.NewReader(`{"luke/x-wing":{"PushEvent":1}}`)); err != nil {
+		t.Fatalf("description: put file, error received: %s", err.Error())
+	}
+
+	if err := f.PutRollup(Day, now, "per-repo-count", strings.NewReader(`{"luke/x-wing":{"PushEvent":2}}`)); err != nil {
+		t.Fatalf("description: put rollup, error received: %s", err.Error())
+	}
+
+	tests := []struct {
+		desc   string
+		period string
+		count  int
+		err    string
+	}{
+		{
+			desc:   "invalid period",
+			period: "decade",
+			count:  0,
+			err:    "invalid report period: decade",
+		},
+		{
+			desc:   "hourly reports",
+			period: Hour,
+			count:  1,
+			err:    "",
+		},
+		{
+			desc:   "day reports",
+			period: Day,
+			count:  2,
+			err:    "",
+		},
+	}
+
+	for _, test := range tests {
+		reports, err := f.GetReports(Query{
+			Start:  now.Add(-time.Hour),
+			End:    now.Add(time.Hour),
+			Period: test.period,
+			Report: "per-repo-count",
+		})
+		if err != nil && err.Error() != test.err {
+			t.Errorf("description: %s, error received: %s, expected: %s", test.desc, err.Error(), test.err)
+		}
+
+		if err == nil && (len(reports) != 1 || reports[0].Counts["luke/x-wing"]["PushEvent"] != test.count) {
+			t.Errorf("description: %s, reports received: %+v, expected count: %d", test.desc, reports, test.count)
+		}
+	}
+
+	paths, err := f.GetPaths()
+	if err != nil {
+		t.Fatalf("description: get paths, error received: %s", err.Error())
+	}
+
+	if len(paths) != 1 || !strings.HasPrefix(paths[0], "file://") {
+		t.Errorf("description: get paths, paths received: %v", paths)
+	}
+
+	// reprocessing an hour replaces its report rather than adding another
+	if err := f.PutFile(year, month, day, hour, "per-repo-count", strings.NewReader(`{"luke/x-wing":{"PushEvent":3}}`)); err != nil {
+		t.Fatalf("description: replace file, error received: %s", err.Error())
+	}
+
+	keys, err := f.ListKeys(fmt.Sprintf("%d/%02d/%02d/%02d", year, month, day, hour))
+	if err != nil || len(keys) != 1 || keys[0] != hourKey(now, "per-repo-count") {
+		t.Fatalf("description: list keys, keys received: %v, error received: %v", keys, err)
+	}
+
+	if err := f.DeleteObject(keys[0]); err != nil {
+		t.Errorf("description: delete object, error received: %s", err.Error())
+	}
+
+	if _, err := f.GetObject(keys[0]); err == nil {
+		t.Errorf("description: get deleted object, no error received")
+	}
+}
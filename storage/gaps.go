@@ -0,0 +1,32 @@
+package storage
+
+import "time"
+
+// MissingHours returns the hours between start and end, inclusive, which
+// have no stored hourly report of the type, oldest first
+func MissingHours(s Storage, report string, start, end time.Time) ([]time.Time, error) {
+	start, end = start.UTC().Truncate(time.Hour), end.UTC().Truncate(time.Hour)
+
+	stored := map[time.Time]bool{}
+	for _, prefix := range prefixes(Hour, start, end) {
+		keys, err := s.ListKeys(prefix)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range keys {
+			if t, period, suffix, ok := parseKey(key); ok && period == Hour && suffix == report {
+				stored[t] = true
+			}
+		}
+	}
+
+	missing := []time.Time{}
+	for t := start; !t.After(end); t = t.Add(time.Hour) {
+		if !stored[t] {
+			missing = append(missing, t)
+		}
+	}
+
+	return missing, nil
+}
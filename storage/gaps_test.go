@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type failingList struct {
+	Storage
+}
+
+func (f *failingList) ListKeys(string) ([]string, error) {
+	return nil, errors.New("list-error")
+}
+
+func TestMissingHours(t *testing.T) {
+	m := NewMemory("")
+	for _, hour := range []int{22, 23} {
+		m.PutFile(1977, 12, 31, hour, "per-repo-count", strings.NewReader(`{}`))
+	}
+	m.PutFile(1978, 1, 1, 1, "per-repo-count", strings.NewReader(`{}`))
+	m.PutFile(1978, 1, 1, 0, "per-org-count", strings.NewReader(`{}`))
+	m.PutRollup(Day, time.Date(1978, 1, 1, 0, 0, 0, 0, time.UTC), "per-repo-count", strings.NewReader(`{}`))
+
+	start := time.Date(1977, 12, 31, 22, 0, 0, 0, time.UTC)
+	end := time.Date(1978, 1, 1, 2, 30, 0, 0, time.UTC)
+
+	output, err := MissingHours(m, "per-repo-count", start, end)
+	if err != nil {
+		t.Fatalf("description: missing hours, error received: %s", err.Error())
+	}
+
+	expected := []time.Time{
+		time.Date(1978, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(1978, 1, 1, 2, 0, 0, 0, time.UTC),
+	}
+	if !reflect.DeepEqual(output, expected) {
+		t.Errorf("description: missing hours, output received: %v, expected: %v", output, expected)
+	}
+
+	if _, err := MissingHours(&failingList{m}, "per-repo-count", start, end); err == nil || err.Error() != "list-error" {
+		t.Errorf("description: list error, error received: %v, expected: list-error", err)
+	}
+}
@@ -0,0 +1,268 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// indexShards is the number of files each day of a report index is split
+// into by repository name hash
+const indexShards = 64
+
+// indexShard holds the hourly report files of a single day restricted to
+// the repositories hashed to the shard, keyed by hour
+type indexShard map[int]File
+
+// shardOf returns the index shard holding the repository
+func shardOf(repo string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(repo))
+	return h.Sum32() % indexShards
+}
+
+// indexKey generates the storage key for an index shard of a day
+func indexKey(report string, day time.Time, shard uint32) string {
+	return fmt.Sprintf("index/%s/%d/%02d/%02d/%02x.json", report, day.Year(), int(day.Month()), day.Day(), shard)
+}
+
+// dayPrefix returns the listing prefix for the hourly reports of a day
+func dayPrefix(day time.Time) string {
+	return fmt.Sprintf("%d/%02d/%02d", day.Year(), int(day.Month()), day.Day())
+}
+
+// staleIndexPrefix returns the prefix of the markers of the report's hours
+// saved again after their day may have been indexed
+func staleIndexPrefix(report string) string {
+	return "index/" + report + "/stale/"
+}
+
+// InvalidateIndex marks the hour's report as saved again so that queries
+// read the hour from its report file until the day's index is rebuilt
+func InvalidateIndex(s Storage, report string, t time.Time) error {
+	return MarkStale(s, staleIndexPrefix(report), t)
+}
+
+// BuildIndex rebuilds the repository index of the report for the day from
+// its hourly report files; every shard is written, including those without
+// any repositories, so that the index records which hours it covers. The
+// stale markers found before reading the reports are cleared afterwards.
+func BuildIndex(s Storage, day time.Time, report string) error {
+	day = PeriodStart(Day, day)
+
+	stale, err := StaleMarkers(s, staleIndexPrefix(report)+dayPrefix(day)+"/")
+	if err != nil {
+		return err
+	}
+
+	keys, err := s.ListKeys(dayPrefix(day))
+	if err != nil {
+		return err
+	}
+
+	shards := make([]indexShard, indexShards)
+	for i := range shards {
+		shards[i] = indexShard{}
+	}
+
+	for _, key := range keys {
+		t, period, suffix, ok := parseKey(key)
+		if !ok || period != Hour || suffix != report || !PeriodStart(Day, t).Equal(day) {
+			continue
+		}
+
+		reader, err := s.GetObject(key)
+		if err != nil {
+			return err
+		}
+
+		file, err := decodeFile(reader)
+		if err != nil {
+			return fmt.Errorf("error decoding file %s: %s", key, err.Error())
+		}
+
+		for _, shard := range shards {
+			entry := shard[t.Hour()]
+			entry.Add(File{
+				Parsed:  file.Parsed,
+				Skipped: file.Skipped,
+			})
+			shard[t.Hour()] = entry
+		}
+
+		for repo, events := range file.Counts {
+			shards[shardOf(repo)][t.Hour()].Counts.Add(Counts{repo: events})
+		}
+	}
+
+	for i, shard := range shards {
+		b, err := json.Marshal(shard)
+		if err != nil {
+			return err
+		}
+
+		if err := s.PutObject(indexKey(report, day, uint32(i)), strings.NewReader(string(b))); err != nil {
+			return err
+		}
+	}
+
+	for _, markers := range stale {
+		for _, key := range markers {
+			if err := s.DeleteObject(key); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// indexedReports retrieves hourly reports for a query on specific
+// repositories from the day index, reading one shard per repository and
+// day; days and hours which have not been indexed, or which were saved
+// again since, are read from the hourly report files instead
+func indexedReports(s Storage, q Query) ([]Report, error) {
+	start := PeriodStart(Hour, q.Start)
+
+	indexed := map[string]bool{}
+	stale := map[time.Time]bool{}
+	for _, prefix := range prefixes(Hour, start, q.End) {
+		keys, err := s.ListKeys("index/" + q.Report + "/" + prefix)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range keys {
+			indexed[key] = true
+		}
+
+		markers, err := StaleMarkers(s, staleIndexPrefix(q.Report)+prefix)
+		if err != nil {
+			return nil, err
+		}
+
+		for t := range markers {
+			stale[t] = true
+		}
+	}
+
+	reports := []Report{}
+	for day := PeriodStart(Day, start); !day.After(q.End); day = day.AddDate(0, 0, 1) {
+		hours, err := readIndex(s, q, day, indexed)
+		if err != nil {
+			return nil, err
+		}
+
+		for hour := range hours {
+			if stale[day.Add(time.Duration(hour)*time.Hour)] {
+				delete(hours, hour)
+			}
+		}
+
+		missing := false
+		for t := day; t.Before(day.AddDate(0, 0, 1)); t = t.Add(time.Hour) {
+			if t.Before(start) || t.After(q.End) {
+				continue
+			}
+
+			if report, ok := hours[t.Hour()]; ok {
+				reports = append(reports, report)
+			} else {
+				missing = true
+			}
+		}
+
+		if !missing {
+			continue
+		}
+
+		keys, err := s.ListKeys(dayPrefix(day))
+		if err != nil {
+			return nil, err
+		}
+
+		unindexed := []string{}
+		for _, key := range keys {
+			if t, _, _, ok := parseKey(key); ok {
+				if _, ok := hours[t.Hour()]; !ok {
+					unindexed = append(unindexed, key)
+				}
+			}
+		}
+
+		dayReports, err := collectReports(unindexed, q, s.GetObject)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, dayReports...)
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Time.Before(reports[j].Time)
+	})
+
+	return reports, nil
+}
+
+// readIndex returns the filtered reports of the day's hours covered by the
+// index shards of every queried repository, keyed by hour
+func readIndex(s Storage, q Query, day time.Time, indexed map[string]bool) (map[int]Report, error) {
+	shards := map[string]indexShard{}
+	for _, repo := range q.Repos {
+		key := indexKey(q.Report, day, shardOf(repo))
+		if _, ok := shards[key]; ok {
+			continue
+		}
+
+		if !indexed[key] {
+			return nil, nil
+		}
+
+		reader, err := s.GetObject(key)
+		if err != nil {
+			return nil, err
+		}
+
+		shard := indexShard{}
+		err = json.NewDecoder(reader).Decode(&shard)
+		if closer, ok := reader.(io.Closer); ok {
+			closer.Close()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error decoding index %s: %s", key, err.Error())
+		}
+		shards[key] = shard
+	}
+
+	output := map[int]Report{}
+	for hour := 0; hour < 24; hour++ {
+		report := Report{
+			Time: day.Add(time.Duration(hour) * time.Hour),
+			File: File{
+				Counts: Counts{},
+			},
+		}
+
+		covered := true
+		for _, shard := range shards {
+			file, ok := shard[hour]
+			if !ok {
+				covered = false
+				break
+			}
+
+			report.Parsed, report.Skipped = file.Parsed, file.Skipped
+			report.Counts.Add(file.Counts.Filter(q.Repos, q.Owners, q.Events))
+		}
+
+		if covered {
+			output[hour] = report
+		}
+	}
+
+	return output, nil
+}
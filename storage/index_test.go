@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_shardOf(t *testing.T) {
+	for _, repo := range []string{"luke/x-wing", "han/falcon", "leia/tantive"} {
+		if shard := shardOf(repo); shard >= indexShards || shard != shardOf(repo) {
+			t.Errorf("description: stable shard for %s, shard received: %d", repo, shard)
+		}
+	}
+}
+
+func TestBuildIndex(t *testing.T) {
+	m := NewMemory("")
+	files := map[int]string{
+		10: `{"parsed":3,"skipped":1,"counts":{"luke/x-wing":{"PushEvent":2},"han/falcon":{"ForkEvent":1}}}`,
+		11: `{"parsed":1,"skipped":0,"counts":{"luke/x-wing":{"WatchEvent":1}}}`,
+	}
+	for hour, file := range files {
+		if err := m.PutFile(1977, 5, 25, hour, "per-repo-count", strings.NewReader(file)); err != nil {
+			t.Fatalf("description: put file, error received: %s", err.Error())
+		}
+	}
+
+	day := time.Date(1977, 5, 25, 0, 0, 0, 0, time.UTC)
+	if err := BuildIndex(m, day, "per-repo-count"); err != nil {
+		t.Fatalf("description: build index, error received: %s", err.Error())
+	}
+
+	keys, _ := m.ListKeys("index/per-repo-count/1977/05/25")
+	if len(keys) != indexShards {
+		t.Errorf("description: build index, shards received: %d, expected: %d", len(keys), indexShards)
+	}
+
+	// changes after indexing are only visible for hours missing from the index
+	if err := m.PutFile(1977, 5, 25, 10, "per-repo-count", strings.NewReader(`{"luke/x-wing":{"PushEvent":9}}`)); err != nil {
+		t.Fatalf("description: put file, error received: %s", err.Error())
+	}
+	if err := m.PutFile(1977, 5, 25, 12, "per-repo-count", strings.NewReader(`{"luke/x-wing":{"IssuesEvent":1}}`)); err != nil {
+		t.Fatalf("description: put file, error received: %s", err.Error())
+	}
+	if err := m.PutFile(1977, 5, 26, 3, "per-repo-count", strings.NewReader(`{"luke/x-wing":{"ForkEvent":1}}`)); err != nil {
+		t.Fatalf("description: put file, error received: %s", err.Error())
+	}
+
+	reports, err := m.GetReports(Query{
+		Start:  day,
+		End:    time.Date(1977, 5, 26, 23, 0, 0, 0, time.UTC),
+		Report: "per-repo-count",
+		Repos:  []string{"luke/x-wing"},
+	})
+	if err != nil {
+		t.Fatalf("description: indexed reports, error received: %s", err.Error())
+	}
+
+	expected := []Report{
+		{
+			Time: time.Date(1977, 5, 25, 10, 0, 0, 0, time.UTC),
+			File: File{Parsed: 3, Skipped: 1, Counts: Counts{"luke/x-wing": {"PushEvent": 2}}},
+		},
+		{
+			Time: time.Date(1977, 5, 25, 11, 0, 0, 0, time.UTC),
+			File: File{Parsed: 1, Counts: Counts{"luke/x-wing": {"WatchEvent": 1}}},
+		},
+		{
+			Time: time.Date(1977, 5, 25, 12, 0, 0, 0, time.UTC),
+			File: File{Counts: Counts{"luke/x-wing": {"IssuesEvent": 1}}},
+		},
+		{
+			Time: time.Date(1977, 5, 26, 3, 0, 0, 0, time.UTC),
+			File: File{Counts: Counts{"luke/x-wing": {"ForkEvent": 1}}},
+		},
+	}
+
+	if len(reports) != len(expected) {
+		t.Fatalf("description: indexed reports, output received: %+v, expected: %+v", reports, expected)
+	}
+
+	for i := range expected {
+		if !reports[i].Time.Equal(expected[i].Time) || !reflect.DeepEqual(reports[i].File, expected[i].File) {
+			t.Errorf("description: indexed reports, output received: %+v, expected: %+v", reports[i], expected[i])
+		}
+	}
+}
+
+func TestInvalidateIndex(t *testing.T) {
+	m := NewMemory("")
+	m.PutFile(1977, 5, 25, 10, "per-repo-count", strings.NewReader(`{"luke/x-wing":{"PushEvent":1}}`))
+
+	day := time.Date(1977, 5, 25, 0, 0, 0, 0, time.UTC)
+	if err := BuildIndex(m, day, "per-repo-count"); err != nil {
+		t.Fatalf("description: build index, error received: %s", err.Error())
+	}
+
+	hour := day.Add(10 * time.Hour)
+	m.PutFile(1977, 5, 25, 10, "per-repo-count", strings.NewReader(`{"luke/x-wing":{"PushEvent":9}}`))
+	if err := InvalidateIndex(m, "per-repo-count", hour); err != nil {
+		t.Fatalf("description: invalidate index, error received: %s", err.Error())
+	}
+
+	q := Query{
+		Start:  hour,
+		End:    hour,
+		Report: "per-repo-count",
+		Repos:  []string{"luke/x-wing"},
+	}
+
+	for _, desc := range []string{"stale hour", "rebuilt index"} {
+		reports, err := m.GetReports(q)
+		if err != nil || len(reports) != 1 || reports[0].Counts["luke/x-wing"]["PushEvent"] != 9 {
+			t.Errorf("description: %s, output received: %+v %v", desc, reports, err)
+		}
+
+		if err := BuildIndex(m, day, "per-repo-count"); err != nil {
+			t.Fatalf("description: %s, error received: %s", desc, err.Error())
+		}
+
+		if keys, _ := m.ListKeys(staleIndexPrefix("per-repo-count")); len(keys) != 0 {
+			t.Errorf("description: %s, stale markers received: %v", desc, keys)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Backfill job and hour statuses; queued hours were accepted by an
+// asynchronous invoker but their reports have not yet been confirmed
+const (
+	Pending = "pending"
+	Running = "running"
+	Queued  = "queued"
+	Done    = "done"
+	Failed  = "failed"
+)
+
+// ErrJobNotFound is returned for backfill jobs which have not been stored
+var ErrJobNotFound = errors.New("job not found")
+
+// JobHour holds the status of a single archive hour within a backfill job
+type JobHour struct {
+	Time     time.Time `json:"time"`
+	Status   string    `json:"status"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Job holds the progress of a backfill over a set of archive hours; Status
+// and Counts summarize the hours and are updated when the job is stored
+type Job struct {
+	ID      string         `json:"id"`
+	Status  string         `json:"status"`
+	Counts  map[string]int `json:"counts"`
+	Created time.Time      `json:"created"`
+	Updated time.Time      `json:"updated"`
+	Hours   []JobHour      `json:"hours"`
+}
+
+// NewJob generates a job with every hour pending
+func NewJob(hours []time.Time) Job {
+	j := Job{
+		ID:      uuid.New().String(),
+		Created: time.Now().UTC(),
+		Hours:   []JobHour{},
+	}
+
+	for _, hour := range hours {
+		j.Hours = append(j.Hours, JobHour{
+			Time:   hour,
+			Status: Pending,
+		})
+	}
+	j.summarize()
+
+	return j
+}
+
+// summarize updates the job status and counts from its hours; a job is
+// running while any hour is, queued while any hour awaits confirmation,
+// failed once every hour has finished with any failures, and done once
+// every hour has succeeded
+func (j *Job) summarize() {
+	j.Counts = map[string]int{
+		Pending: 0,
+		Running: 0,
+		Queued:  0,
+		Done:    0,
+		Failed:  0,
+	}
+	for _, hour := range j.Hours {
+		j.Counts[hour.Status]++
+	}
+
+	switch {
+	case j.Counts[Running] > 0:
+		j.Status = Running
+	case j.Counts[Pending] > 0:
+		j.Status = Pending
+	case j.Counts[Queued] > 0:
+		j.Status = Queued
+	case j.Counts[Failed] > 0:
+		j.Status = Failed
+	default:
+		j.Status = Done
+	}
+}
+
+// Unfinished returns the indexes of the hours which have not succeeded
+func (j Job) Unfinished() []int {
+	output := []int{}
+	for i, hour := range j.Hours {
+		if hour.Status != Done {
+			output = append(output, i)
+		}
+	}
+	return output
+}
+
+// ConfirmQueued marks the queued hours of the job which have a stored
+// report of the type as done, returning the number confirmed
+func ConfirmQueued(s Storage, j *Job, report string) (int, error) {
+	var start, end time.Time
+	for _, hour := range j.Hours {
+		if hour.Status != Queued {
+			continue
+		}
+
+		if start.IsZero() || hour.Time.Before(start) {
+			start = hour.Time
+		}
+		if end.IsZero() || hour.Time.After(end) {
+			end = hour.Time
+		}
+	}
+
+	if start.IsZero() {
+		return 0, nil
+	}
+
+	missing, err := MissingHours(s, report, start, end)
+	if err != nil {
+		return 0, err
+	}
+
+	unconfirmed := map[time.Time]bool{}
+	for _, t := range missing {
+		unconfirmed[t] = true
+	}
+
+	confirmed := 0
+	for i, hour := range j.Hours {
+		if hour.Status == Queued && !unconfirmed[hour.Time.UTC().Truncate(time.Hour)] {
+			j.Hours[i].Status = Done
+			confirmed++
+		}
+	}
+	j.summarize()
+
+	return confirmed, nil
+}
+
+func jobKey(id string) string {
+	return "jobs/" + id + ".json"
+}
+
+// PutJob updates the job summary and stores it, replacing any previous
+// version
+func PutJob(s Storage, j *Job) error {
+	j.summarize()
+	j.Updated = time.Now().UTC()
+
+	b, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+
+	return s.PutObject(jobKey(j.ID), bytes.NewReader(b))
+}
+
+// GetJob retrieves the job, returning ErrJobNotFound when it does not exist
+func GetJob(s Storage, id string) (Job, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return Job{}, errors.New("invalid job id: " + id)
+	}
+
+	keys, err := s.ListKeys(jobKey(id))
+	if err != nil {
+		return Job{}, err
+	}
+
+	if len(keys) == 0 || keys[0] != jobKey(id) {
+		return Job{}, ErrJobNotFound
+	}
+
+	reader, err := s.GetObject(jobKey(id))
+	if err != nil {
+		return Job{}, err
+	}
+
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	j := Job{}
+	if err := json.NewDecoder(reader).Decode(&j); err != nil {
+		return Job{}, fmt.Errorf("error decoding job %s: %s", id, err.Error())
+	}
+
+	return j, nil
+}
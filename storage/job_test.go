@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJob(t *testing.T) {
+	start := time.Date(1977, 5, 25, 20, 0, 0, 0, time.UTC)
+	j := NewJob([]time.Time{start, start.Add(time.Hour), start.Add(2 * time.Hour)})
+
+	if j.Status != Pending || j.Counts[Pending] != 3 {
+		t.Errorf("description: new job, output received: %+v", j)
+	}
+
+	tests := []struct {
+		desc       string
+		statuses   []string
+		status     string
+		unfinished []int
+	}{
+		{
+			desc:       "running hours",
+			statuses:   []string{Done, Running, Pending},
+			status:     Running,
+			unfinished: []int{1, 2},
+		},
+		{
+			desc:       "queued hours",
+			statuses:   []string{Done, Queued, Failed},
+			status:     Queued,
+			unfinished: []int{1, 2},
+		},
+		{
+			desc:       "finished with failures",
+			statuses:   []string{Done, Failed, Done},
+			status:     Failed,
+			unfinished: []int{1},
+		},
+		{
+			desc:       "every hour done",
+			statuses:   []string{Done, Done, Done},
+			status:     Done,
+			unfinished: []int{},
+		},
+	}
+
+	for _, test := range tests {
+		for i, status := range test.statuses {
+			j.Hours[i].Status = status
+		}
+		j.summarize()
+
+		if j.Status != test.status || !reflect.DeepEqual(j.Unfinished(), test.unfinished) {
+			t.Errorf("description: %s, output received: %s %v, expected: %s %v", test.desc, j.Status, j.Unfinished(), test.status, test.unfinished)
+		}
+	}
+}
+
+func TestConfirmQueued(t *testing.T) {
+	m := NewMemory("")
+	start := time.Date(1977, 5, 25, 20, 0, 0, 0, time.UTC)
+	j := NewJob([]time.Time{start, start.Add(time.Hour), start.Add(2 * time.Hour)})
+	for i, status := range []string{Failed, Queued, Queued} {
+		j.Hours[i].Status = status
+	}
+
+	m.PutFile(1977, 5, 25, 20, "per-repo-count", strings.NewReader(`{}`))
+	m.PutFile(1977, 5, 25, 21, "per-repo-count", strings.NewReader(`{}`))
+
+	confirmed, err := ConfirmQueued(m, &j, "per-repo-count")
+	if err != nil {
+		t.Fatalf("description: confirm queued, error received: %s", err.Error())
+	}
+
+	if confirmed != 1 || j.Hours[0].Status != Failed || j.Hours[1].Status != Done || j.Hours[2].Status != Queued || j.Status != Queued {
+		t.Errorf("description: confirm queued, output received: %d %+v", confirmed, j)
+	}
+
+	if _, err := ConfirmQueued(&failingList{m}, &j, "per-repo-count"); err == nil {
+		t.Errorf("description: list error, error received: nil")
+	}
+}
+
+func TestPutGetJob(t *testing.T) {
+	m := NewMemory("")
+	j := NewJob([]time.Time{time.Date(1977, 5, 25, 20, 0, 0, 0, time.UTC)})
+	j.Hours[0].Status = Failed
+
+	if _, err := GetJob(m, "../watchlist/rebels"); err == nil {
+		t.Errorf("description: invalid id, error received: nil")
+	}
+
+	if _, err := GetJob(m, j.ID); err != ErrJobNotFound {
+		t.Errorf("description: missing job, error received: %v, expected: %s", err, ErrJobNotFound)
+	}
+
+	if err := PutJob(m, &j); err != nil {
+		t.Fatalf("description: put job, error received: %s", err.Error())
+	}
+
+	output, err := GetJob(m, j.ID)
+	if err != nil {
+		t.Fatalf("description: get job, error received: %s", err.Error())
+	}
+
+	if output.Status != Failed || output.Updated.IsZero() || len(output.Hours) != 1 || !output.Hours[0].Time.Equal(j.Hours[0].Time) {
+		t.Errorf("description: get job, output received: %+v", output)
+	}
+}
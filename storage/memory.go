@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory implements Storage in process memory for local runs and tests
+type Memory struct {
+	mutex   sync.RWMutex
+	objects map[string][]byte
+	baseURL string
+}
+
+// NewMemory generates an in-memory implementation; paths are returned
+// relative to the base URL the Memory is served from as an http.Handler
+func NewMemory(baseURL string) *Memory {
+	return &Memory{
+		objects: map[string][]byte{},
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+// PutObject persists a file in memory under the key, replacing any previous version
+func (m *Memory) PutObject(key string, file io.Reader) error {
+	b, err := ioutil.ReadAll(file)
+	if err != nil {
+		return fmt.Errorf("error putting file: %s", err.Error())
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.objects[key] = b
+	return nil
+}
+
+// GetObject retrieves the file stored in memory under the key
+func (m *Memory) GetObject(key string) (io.Reader, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	b, ok := m.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("error getting object %s: not found", key)
+	}
+
+	return bytes.NewReader(b), nil
+}
+
+// ListKeys retrieves the sorted keys of all files stored in memory
+// beginning with the prefix
+func (m *Memory) ListKeys(prefix string) ([]string, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	keys := []string{}
+	for key := range m.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// DeleteObject removes the file stored in memory under the key
+func (m *Memory) DeleteObject(key string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.objects[key]; !ok {
+		return fmt.Errorf("error deleting object %s: not found", key)
+	}
+
+	delete(m.objects, key)
+	return nil
+}
+
+// PutFile persists a JSON file in memory
+func (m *Memory) PutFile(year, month, day, hour int, suffix string, file io.Reader) error {
+	key := hourKey(time.Date(year, time.Month(month), day, hour, 0, 0, 0, time.UTC), suffix)
+	return m.PutObject(key, file)
+}
+
+// PutRollup persists a JSON report file covering the day, week, or month
+// beginning at the provided time in memory, replacing any previous version
+func (m *Memory) PutRollup(period string, t time.Time, suffix string, file io.Reader) error {
+	key, err := rollupKey(period, t, suffix)
+	if err != nil {
+		return err
+	}
+
+	return m.PutObject(key, file)
+}
+
+// GetReports retrieves filtered report data stored in memory
+func (m *Memory) GetReports(q Query) ([]Report, error) {
+	period, start, err := reportWindow(q)
+	if err != nil {
+		return nil, err
+	}
+
+	if period == Hour && len(q.Repos) > 0 {
+		return indexedReports(m, q)
+	}
+
+	keys := []string{}
+	for _, prefix := range prefixes(period, start, q.End) {
+		prefixKeys, _ := m.ListKeys(prefix)
+		keys = append(keys, prefixKeys...)
+	}
+
+	return collectReports(keys, q, m.GetObject)
+}
+
+// GetPaths retrieves URLs for hourly reports stored in memory over the
+// rolling 12 month window, oldest first
+func (m *Memory) GetPaths() ([]string, error) {
+	paths := []string{}
+	for _, prefix := range pathPrefixes(time.Now()) {
+		keys, _ := m.ListKeys(prefix)
+		for _, key := range hourKeys(keys) {
+			paths = append(paths, m.baseURL+"/"+key)
+		}
+	}
+
+	return paths, nil
+}
+
+// ServeHTTP serves stored hourly reports by key so that GetPaths output is
+// usable without exposing any other stored objects
+func (m *Memory) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	if len(hourKeys([]string{key})) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	file, err := m.GetObject(key)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	io.Copy(w, file)
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemory(t *testing.T) {
+	m := NewMemory("")
+	server := httptest.NewServer(m)
+	defer server.Close()
+	m.baseURL = server.URL
+
+	now := time.Now().UTC().Add(-time.Hour)
+	year, month, day, hour := now.Year(), int(now.Month()), now.Day(), now.Hour()
+
+	if err := m.PutFile(year, month, day, hour, "per-repo-count", strings.NewReader(`{"luke/x-wing":{"PushEvent":1}}`)); err != nil {
+		t.Fatalf("description: put file, error received: %s", err.Error())
+	}
+
+	if err := m.PutRollup(Month, now, "per-repo-count", strings.NewReader(`{"luke/x-wing":{"PushEvent":2}}`)); err != nil {
+		t.Fatalf("description: put rollup, error received: %s", err.Error())
+	}
+
+	tests := []struct {
+		desc   string
+		period string
+		count  int
+	}{
+		{
+			desc:   "hourly reports",
+			period: Hour,
+			count:  1,
+		},
+		{
+			desc:   "month reports",
+			period: Month,
+			count:  2,
+		},
+	}
+
+	for _, test := range tests {
+		reports, err := m.GetReports(Query{
+			Start:  now,
+			End:    now,
+			Period: test.period,
+			Report: "per-repo-count",
+		})
+		if err != nil {
+			t.Errorf("description: %s, error received: %s", test.desc, err.Error())
+		}
+
+		if len(reports) != 1 || reports[0].Counts["luke/x-wing"]["PushEvent"] != test.count {
+			t.Errorf("description: %s, reports received: %+v, expected count: %d", test.desc, reports, test.count)
+		}
+	}
+
+	paths, err := m.GetPaths()
+	if err != nil || len(paths) != 1 {
+		t.Fatalf("description: get paths, paths received: %v, error received: %v", paths, err)
+	}
+
+	resp, err := http.Get(paths[0])
+	if err != nil {
+		t.Fatalf("description: get path, error received: %s", err.Error())
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != `{"luke/x-wing":{"PushEvent":1}}` {
+		t.Errorf("description: get path, body received: %s", body)
+	}
+
+	resp, err = http.Get(server.URL + "/missing.json")
+	if err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("description: get missing path, response received: %v, error received: %v", resp, err)
+	}
+
+	rollup, _ := rollupKey(Month, now, "per-repo-count")
+	resp, err = http.Get(server.URL + "/" + rollup)
+	if err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("description: get non-hourly path, response received: %v, error received: %v", resp, err)
+	}
+
+	key := hourKey(now, "per-repo-count")
+	if err := m.DeleteObject(key); err != nil {
+		t.Errorf("description: delete object, error received: %s", err.Error())
+	}
+
+	if err := m.DeleteObject(key); err == nil || err.Error() != "error deleting object "+key+": not found" {
+		t.Errorf("description: delete missing object, error received: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+)
+
+// total returns the sum of all counts in the file
+func (f File) total() int {
+	output := 0
+	for _, events := range f.Counts {
+		for _, count := range events {
+			output += count
+		}
+	}
+	return output
+}
+
+// Deduplicate migrates hourly report files stored under the previous
+// random keys beneath the prefix to their deterministic keys. Where an
+// hour has several files for the same report type, the most complete one
+// (most parsed lines, then most events) is kept and the rest are removed.
+// It returns the number of files removed.
+func Deduplicate(s Storage, prefix string) (int, error) {
+	keys, err := s.ListKeys(prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	groups := map[string][]string{}
+	for _, key := range keys {
+		t, period, suffix, ok := parseKey(key)
+		if !ok || period != Hour {
+			continue
+		}
+
+		target := hourKey(t, suffix)
+		groups[target] = append(groups[target], key)
+	}
+
+	targets := []string{}
+	for target, group := range groups {
+		if len(group) > 1 || group[0] != target {
+			targets = append(targets, target)
+		}
+	}
+	sort.Strings(targets)
+
+	removed := 0
+	for _, target := range targets {
+		best, bestData, bestFile := "", []byte(nil), File{}
+		for _, key := range groups[target] {
+			reader, err := s.GetObject(key)
+			if err != nil {
+				return removed, err
+			}
+
+			data, err := ioutil.ReadAll(reader)
+			if closer, ok := reader.(io.Closer); ok {
+				closer.Close()
+			}
+			if err != nil {
+				return removed, fmt.Errorf("error reading file %s: %s", key, err.Error())
+			}
+
+			file, err := decodeFile(bytes.NewReader(data))
+			if err != nil {
+				return removed, fmt.Errorf("error decoding file %s: %s", key, err.Error())
+			}
+
+			if best == "" || file.Parsed > bestFile.Parsed || (file.Parsed == bestFile.Parsed && file.total() > bestFile.total()) {
+				best, bestData, bestFile = key, data, file
+			}
+		}
+
+		if best != target {
+			if err := s.PutObject(target, bytes.NewReader(bestData)); err != nil {
+				return removed, err
+			}
+		}
+
+		for _, key := range groups[target] {
+			if key == target {
+				continue
+			}
+
+			if err := s.DeleteObject(key); err != nil {
+				return removed, err
+			}
+			removed++
+		}
+	}
+
+	return removed, nil
+}
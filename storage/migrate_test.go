@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type failingMemory struct {
+	*Memory
+	deleteErr error
+}
+
+func (f *failingMemory) DeleteObject(key string) error {
+	return f.deleteErr
+}
+
+type trackedReader struct {
+	io.Reader
+	open *int
+}
+
+func (r *trackedReader) Close() error {
+	*r.open--
+	return nil
+}
+
+type trackingMemory struct {
+	*Memory
+	open int
+}
+
+func (t *trackingMemory) GetObject(key string) (io.Reader, error) {
+	reader, err := t.Memory.GetObject(key)
+	if err != nil {
+		return nil, err
+	}
+
+	t.open++
+	return &trackedReader{
+		Reader: reader,
+		open:   &t.open,
+	}, nil
+}
+
+func TestDeduplicateCloses(t *testing.T) {
+	m := NewMemory("")
+	m.PutObject("1977/05/25/20/count/5f0e3c1a-8a4e-4f1e-9a8c-2b8e4c6d7f10-per-repo-count.json", strings.NewReader(`{}`))
+	m.PutObject("1977/05/25/20/count/per-repo-count.json", strings.NewReader(`{}`))
+
+	s := &trackingMemory{
+		Memory: m,
+	}
+	if _, err := Deduplicate(s, ""); err != nil {
+		t.Fatalf("description: deduplicate, error received: %s", err.Error())
+	}
+
+	if s.open != 0 {
+		t.Errorf("description: deduplicate, open readers received: %d, expected: 0", s.open)
+	}
+}
+
+func TestDeduplicate(t *testing.T) {
+	files := map[string]string{
+		"1977/05/25/20/count/5f0e3c1a-8a4e-4f1e-9a8c-2b8e4c6d7f10-per-repo-count.json": `{"luke/x-wing":{"PushEvent":1}}`,
+		"1977/05/25/20/count/6a1f4d2b-9b5f-4a2f-8b9d-3c9f5d7e8a21-per-repo-count.json": `{"luke/x-wing":{"PushEvent":3}}`,
+		"1977/05/25/20/count/per-repo-count.json":                                      `{"luke/x-wing":{"PushEvent":2}}`,
+		"1977/05/25/21/count/7b2a5e3c-0c6a-4b3a-9cae-4daa6e8f9b32-per-repo-count.json": `{"parsed":4,"skipped":0,"counts":{"luke/x-wing":{"PushEvent":4}}}`,
+		"1977/05/25/21/count/8c3b6f4d-1d7b-4c4b-8dbf-5ebb7f9a0c43-per-repo-count.json": `{"parsed":5,"skipped":0,"counts":{"luke/x-wing":{"PushEvent":1}}}`,
+		"1977/05/25/22/count/per-repo-count.json":                                      `{"luke/x-wing":{"PushEvent":6}}`,
+		"day/1977/05/25/per-repo-count.json":                                           `{"luke/x-wing":{"PushEvent":7}}`,
+	}
+
+	tests := []struct {
+		desc      string
+		deleteErr error
+		removed   int
+		keys      map[string]string
+		err       string
+	}{
+		{
+			desc:      "delete object error",
+			deleteErr: errors.New("delete error"),
+			removed:   0,
+			keys:      nil,
+			err:       "delete error",
+		},
+		{
+			desc:      "successful invocation",
+			deleteErr: nil,
+			removed:   4,
+			keys: map[string]string{
+				"1977/05/25/20/count/per-repo-count.json": `{"luke/x-wing":{"PushEvent":3}}`,
+				"1977/05/25/21/count/per-repo-count.json": `{"parsed":5,"skipped":0,"counts":{"luke/x-wing":{"PushEvent":1}}}`,
+				"1977/05/25/22/count/per-repo-count.json": `{"luke/x-wing":{"PushEvent":6}}`,
+				"day/1977/05/25/per-repo-count.json":      `{"luke/x-wing":{"PushEvent":7}}`,
+			},
+			err: "",
+		},
+	}
+
+	for _, test := range tests {
+		m := NewMemory("")
+		for key, value := range files {
+			m.PutObject(key, strings.NewReader(value))
+		}
+
+		var s Storage = m
+		if test.deleteErr != nil {
+			s = &failingMemory{
+				Memory:    m,
+				deleteErr: test.deleteErr,
+			}
+		}
+
+		removed, err := Deduplicate(s, "")
+		if err != nil && err.Error() != test.err {
+			t.Errorf("description: %s, error received: %s, expected: %s", test.desc, err.Error(), test.err)
+		}
+
+		if removed != test.removed {
+			t.Errorf("description: %s, removed received: %d, expected: %d", test.desc, removed, test.removed)
+		}
+
+		if test.keys == nil {
+			continue
+		}
+
+		keys := map[string]string{}
+		stored, _ := m.ListKeys("")
+		for _, key := range stored {
+			reader, _ := m.GetObject(key)
+			keys[key] = readString(reader)
+		}
+
+		if !reflect.DeepEqual(keys, test.keys) {
+			t.Errorf("description: %s, keys received: %v, expected: %v", test.desc, keys, test.keys)
+		}
+	}
+}
+
+func readString(r io.Reader) string {
+	b, _ := ioutil.ReadAll(r)
+	return string(b)
+}
@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Report periods supported by stored files
+const (
+	Hour  = "hour"
+	Day   = "day"
+	Week  = "week"
+	Month = "month"
+)
+
+// PeriodStart truncates the time to the beginning of its period; weeks
+// follow ISO 8601 and begin on Mondays
+func PeriodStart(period string, t time.Time) time.Time {
+	t = t.UTC()
+	switch period {
+	case Day:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	case Week:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	case Month:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return t.Truncate(time.Hour)
+}
+
+// PeriodNext returns the beginning of the period following the one
+// beginning at the provided time
+func PeriodNext(period string, t time.Time) time.Time {
+	switch period {
+	case Day:
+		return t.AddDate(0, 0, 1)
+	case Week:
+		return t.AddDate(0, 0, 7)
+	case Month:
+		return t.AddDate(0, 1, 0)
+	}
+	return t.Add(time.Hour)
+}
+
+// ValidPeriod reports whether the period is supported
+func ValidPeriod(period string) bool {
+	return period == Hour || period == Day || period == Week || period == Month
+}
+
+// hourKey generates the storage key for an hourly report file
+func hourKey(t time.Time, name string) string {
+	return fmt.Sprintf("%d/%02d/%02d/%02d/count/%s.json", t.Year(), int(t.Month()), t.Day(), t.Hour(), name)
+}
+
+// rollupKey generates the storage key for a day, week, or month report file
+func rollupKey(period string, t time.Time, suffix string) (string, error) {
+	t = PeriodStart(period, t)
+	switch period {
+	case Day:
+		return fmt.Sprintf("%s/%d/%02d/%02d/%s.json", period, t.Year(), int(t.Month()), t.Day(), suffix), nil
+	case Week:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%s/%d/%02d/%s.json", period, year, week, suffix), nil
+	case Month:
+		return fmt.Sprintf("%s/%d/%02d/%s.json", period, t.Year(), int(t.Month()), suffix), nil
+	}
+	return "", fmt.Errorf("invalid rollup period: %s", period)
+}
+
+// DeleteRollup removes the stored report file for the period containing t
+// when there is one
+func DeleteRollup(s Storage, period string, t time.Time, suffix string) error {
+	key, err := rollupKey(period, t, suffix)
+	if err != nil {
+		return err
+	}
+
+	keys, err := s.ListKeys(key)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		if k == key {
+			return s.DeleteObject(key)
+		}
+	}
+
+	return nil
+}
+
+// parseKey extracts the period start, period, and suffix from a report key
+func parseKey(key string) (time.Time, string, string, bool) {
+	parts := strings.Split(key, "/")
+	name := strings.TrimSuffix(parts[len(parts)-1], ".json")
+
+	switch {
+	case len(parts) == 6 && parts[4] == "count":
+		t, err := time.Parse("2006/01/02/15", strings.Join(parts[:4], "/"))
+		if err != nil {
+			return time.Time{}, "", "", false
+		}
+
+		if len(name) > 37 && name[36] == '-' {
+			if _, err := uuid.Parse(name[:36]); err == nil {
+				name = name[37:]
+			}
+		}
+
+		return t, Hour, name, true
+
+	case len(parts) == 5 && parts[0] == Day:
+		t, err := time.Parse("2006/01/02", strings.Join(parts[1:4], "/"))
+		if err != nil {
+			return time.Time{}, "", "", false
+		}
+		return t, Day, name, true
+
+	case len(parts) == 4 && parts[0] == Week:
+		year, yearErr := strconv.Atoi(parts[1])
+		week, weekErr := strconv.Atoi(parts[2])
+		if yearErr != nil || weekErr != nil || week < 1 || week > 53 {
+			return time.Time{}, "", "", false
+		}
+
+		// January 4th always falls in the first ISO week of the year
+		first := PeriodStart(Week, time.Date(year, 1, 4, 0, 0, 0, 0, time.UTC))
+		return first.AddDate(0, 0, (week-1)*7), Week, name, true
+
+	case len(parts) == 4 && parts[0] == Month:
+		t, err := time.Parse("2006/01", strings.Join(parts[1:3], "/"))
+		if err != nil {
+			return time.Time{}, "", "", false
+		}
+		return t, Month, name, true
+	}
+
+	return time.Time{}, "", "", false
+}
+
+// prefixes returns the listing prefixes covering the period between start
+// and end
+func prefixes(period string, start, end time.Time) []string {
+	output := []string{}
+	if period == Hour {
+		current := PeriodStart(Month, start)
+		for !current.After(end) {
+			output = append(output, fmt.Sprintf("%d/%02d", current.Year(), int(current.Month())))
+			current = current.AddDate(0, 1, 0)
+		}
+		return output
+	}
+
+	startYear, endYear := start.Year(), end.Year()
+	if period == Week {
+		startYear, _ = start.ISOWeek()
+		endYear, _ = end.ISOWeek()
+	}
+
+	for year := startYear; year <= endYear; year++ {
+		output = append(output, fmt.Sprintf("%s/%d", period, year))
+	}
+	return output
+}
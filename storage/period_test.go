@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPeriodStart(t *testing.T) {
+	input := time.Date(1977, 5, 25, 20, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		desc   string
+		period string
+		output time.Time
+	}{
+		{
+			desc:   "hour period",
+			period: Hour,
+			output: time.Date(1977, 5, 25, 20, 0, 0, 0, time.UTC),
+		},
+		{
+			desc:   "day period",
+			period: Day,
+			output: time.Date(1977, 5, 25, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			desc:   "week period",
+			period: Week,
+			output: time.Date(1977, 5, 23, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			desc:   "month period",
+			period: Month,
+			output: time.Date(1977, 5, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, test := range tests {
+		output := PeriodStart(test.period, input)
+		if !output.Equal(test.output) {
+			t.Errorf("description: %s, output received: %s, expected: %s", test.desc, output, test.output)
+		}
+	}
+}
+
+func Test_rollupKey(t *testing.T) {
+	input := time.Date(1977, 1, 1, 20, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		desc   string
+		period string
+		key    string
+		err    string
+	}{
+		{
+			desc:   "invalid period",
+			period: Hour,
+			key:    "",
+			err:    "invalid rollup period: hour",
+		},
+		{
+			desc:   "day period",
+			period: Day,
+			key:    "day/1977/01/01/per-repo-count.json",
+			err:    "",
+		},
+		{
+			desc:   "week period in previous iso year",
+			period: Week,
+			key:    "week/1976/53/per-repo-count.json",
+			err:    "",
+		},
+		{
+			desc:   "month period",
+			period: Month,
+			key:    "month/1977/01/per-repo-count.json",
+			err:    "",
+		},
+	}
+
+	for _, test := range tests {
+		key, err := rollupKey(test.period, input, "per-repo-count")
+		if err != nil && err.Error() != test.err {
+			t.Errorf("description: %s, error received: %s, expected: %s", test.desc, err.Error(), test.err)
+		}
+
+		if key != test.key {
+			t.Errorf("description: %s, key received: %s, expected: %s", test.desc, key, test.key)
+		}
+	}
+}
+
+func Test_parseKey(t *testing.T) {
+	tests := []struct {
+		desc   string
+		key    string
+		time   time.Time
+		period string
+		suffix string
+		ok     bool
+	}{
+		{
+			desc:   "invalid key layout",
+			key:    "1977/05/25/per-repo-count.json",
+			time:   time.Time{},
+			period: "",
+			suffix: "",
+			ok:     false,
+		},
+		{
+			desc:   "invalid key time",
+			key:    "1977/05/32/20/count/per-repo-count.json",
+			time:   time.Time{},
+			period: "",
+			suffix: "",
+			ok:     false,
+		},
+		{
+			desc:   "uuid prefixed hour key",
+			key:    "1977/05/25/20/count/5f0e3c1a-8a4e-4f1e-9a8c-2b8e4c6d7f10-per-repo-count.json",
+			time:   time.Date(1977, 5, 25, 20, 0, 0, 0, time.UTC),
+			period: Hour,
+			suffix: "per-repo-count",
+			ok:     true,
+		},
+		{
+			desc:   "day key",
+			key:    "day/1977/05/25/per-repo-count.json",
+			time:   time.Date(1977, 5, 25, 0, 0, 0, 0, time.UTC),
+			period: Day,
+			suffix: "per-repo-count",
+			ok:     true,
+		},
+		{
+			desc:   "week key",
+			key:    "week/1976/53/per-repo-count.json",
+			time:   time.Date(1976, 12, 27, 0, 0, 0, 0, time.UTC),
+			period: Week,
+			suffix: "per-repo-count",
+			ok:     true,
+		},
+		{
+			desc:   "month key",
+			key:    "month/1977/05/per-repo-count.json",
+			time:   time.Date(1977, 5, 1, 0, 0, 0, 0, time.UTC),
+			period: Month,
+			suffix: "per-repo-count",
+			ok:     true,
+		},
+	}
+
+	for _, test := range tests {
+		tm, period, suffix, ok := parseKey(test.key)
+		if ok != test.ok || period != test.period || suffix != test.suffix || !tm.Equal(test.time) {
+			t.Errorf("description: %s, received: %s %s %s %t, expected: %s %s %s %t", test.desc, tm, period, suffix, ok, test.time, test.period, test.suffix, test.ok)
+		}
+	}
+}
+
+func Test_prefixes(t *testing.T) {
+	tests := []struct {
+		desc   string
+		period string
+		start  time.Time
+		end    time.Time
+		output []string
+	}{
+		{
+			desc:   "hour period across years",
+			period: Hour,
+			start:  time.Date(1977, 12, 25, 0, 0, 0, 0, time.UTC),
+			end:    time.Date(1978, 1, 2, 0, 0, 0, 0, time.UTC),
+			output: []string{"1977/12", "1978/01"},
+		},
+		{
+			desc:   "week period in iso years",
+			period: Week,
+			start:  time.Date(1976, 12, 27, 0, 0, 0, 0, time.UTC),
+			end:    time.Date(1977, 1, 2, 0, 0, 0, 0, time.UTC),
+			output: []string{"week/1976"},
+		},
+	}
+
+	for _, test := range tests {
+		output := prefixes(test.period, test.start, test.end)
+		if len(output) != len(test.output) {
+			t.Errorf("description: %s, output received: %v, expected: %v", test.desc, output, test.output)
+			continue
+		}
+
+		for i := range output {
+			if output[i] != test.output[i] {
+				t.Errorf("description: %s, output received: %v, expected: %v", test.desc, output, test.output)
+			}
+		}
+	}
+}
+
+func TestDeleteRollup(t *testing.T) {
+	m := NewMemory("")
+	day := time.Date(1977, 5, 25, 0, 0, 0, 0, time.UTC)
+	m.PutRollup(Day, day, "per-repo-count", strings.NewReader(`{}`))
+	m.PutRollup(Day, day, "per-repo-counts", strings.NewReader(`{}`))
+
+	for i := 0; i < 2; i++ {
+		if err := DeleteRollup(m, Day, day.Add(20*time.Hour), "per-repo-count"); err != nil {
+			t.Fatalf("description: delete rollup %d, error received: %s", i, err.Error())
+		}
+	}
+
+	keys, _ := m.ListKeys("day/")
+	if len(keys) != 1 || keys[0] != "day/1977/05/25/per-repo-counts.json" {
+		t.Errorf("description: delete rollup, keys received: %v", keys)
+	}
+
+	if err := DeleteRollup(m, "decade", day, "per-repo-count"); err == nil {
+		t.Error("description: invalid period, error received: nil")
+	}
+}
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// staleKey generates the key of a marker under the prefix recording that
+// the hour was saved again; every save writes its own marker so that work
+// rebuilt from the markers only clears the markers it has seen
+func staleKey(prefix string, t time.Time) string {
+	return fmt.Sprintf("%s%d/%02d/%02d/%02d-%s.json", prefix, t.Year(), int(t.Month()), t.Day(), t.Hour(), uuid.New().String())
+}
+
+// parseStaleKey extracts the marked hour from the end of a stale marker key
+func parseStaleKey(key string) (time.Time, bool) {
+	parts := strings.Split(key, "/")
+	if len(parts) < 4 {
+		return time.Time{}, false
+	}
+
+	parts = parts[len(parts)-4:]
+	if len(parts[3]) < 3 || parts[3][2] != '-' {
+		return time.Time{}, false
+	}
+
+	t, err := time.Parse("2006/01/02/15", fmt.Sprintf("%s/%s/%s/%s", parts[0], parts[1], parts[2], parts[3][:2]))
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return t, true
+}
+
+// MarkStale writes a marker under the prefix recording that the hour was
+// saved again
+func MarkStale(s Storage, prefix string, t time.Time) error {
+	return s.PutObject(staleKey(prefix, t.UTC()), strings.NewReader("{}"))
+}
+
+// StaleMarkers returns the keys of the markers under the prefix, which may
+// extend into the marked hours' dates, keyed by the hour they mark
+func StaleMarkers(s Storage, prefix string) (map[time.Time][]string, error) {
+	keys, err := s.ListKeys(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	output := map[time.Time][]string{}
+	for _, key := range keys {
+		if t, ok := parseStaleKey(key); ok {
+			output[t] = append(output[t], key)
+		}
+	}
+
+	return output, nil
+}
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_parseStaleKey(t *testing.T) {
+	hour := time.Date(1977, 5, 25, 20, 0, 0, 0, time.UTC)
+	if output, ok := parseStaleKey(staleKey("rollups/stale/", hour)); !ok || !output.Equal(hour) {
+		t.Errorf("description: stale key, output received: %s %t, expected: %s", output, ok, hour)
+	}
+
+	if _, ok := parseStaleKey(indexKey("per-repo-count", hour, 1)); ok {
+		t.Error("description: shard key, output received: true, expected: false")
+	}
+}
+
+func TestStaleMarkers(t *testing.T) {
+	m := NewMemory("")
+	hour := time.Date(1977, 5, 25, 20, 0, 0, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		if err := MarkStale(m, "rollups/stale/", hour); err != nil {
+			t.Fatalf("description: mark stale, error received: %s", err.Error())
+		}
+	}
+
+	if err := MarkStale(m, "rollups/stale/", hour.AddDate(0, 1, 0)); err != nil {
+		t.Fatalf("description: mark stale, error received: %s", err.Error())
+	}
+
+	markers, err := StaleMarkers(m, "rollups/stale/1977/05")
+	if err != nil {
+		t.Fatalf("description: stale markers, error received: %s", err.Error())
+	}
+
+	if len(markers) != 1 || len(markers[hour]) != 2 {
+		t.Errorf("description: stale markers, output received: %v, expected: 2 markers of %s", markers, hour)
+	}
+}
@@ -1,17 +1,18 @@
 package storage
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"strconv"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/google/uuid"
 )
 
 type s3Client interface {
@@ -19,12 +20,145 @@ type s3Client interface {
 	GetObjectRequest(input *s3.GetObjectInput) (req *request.Request, output *s3.GetObjectOutput)
 	ListObjectsV2(input *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error)
 	PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error)
+	DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error)
 }
 
-// Storage provides helper methods for persisting/retrieving files
+// Storage provides helper methods for persisting/retrieving files; the
+// object methods operate on raw keys for data outside the report layout
 type Storage interface {
+	// PutFile stores a report under a key determined by the hour and
+	// report type so that reprocessing an hour replaces its previous report
 	PutFile(int, int, int, int, string, io.Reader) error
 	GetPaths() ([]string, error)
+	GetReports(Query) ([]Report, error)
+	PutRollup(string, time.Time, string, io.Reader) error
+	ListKeys(string) ([]string, error)
+	GetObject(string) (io.Reader, error)
+	PutObject(string, io.Reader) error
+	DeleteObject(string) error
+}
+
+// Counts maps repository names to per-event type counts
+type Counts map[string]map[string]int
+
+// Filter returns the subset of counts matching the provided repositories,
+// owners, and event types; empty slices match everything
+func (c Counts) Filter(repos, owners, events []string) Counts {
+	output := Counts{}
+	for repo, repoEvents := range c {
+		if len(repos) > 0 && !contains(repos, repo) {
+			continue
+		}
+
+		if len(owners) > 0 && !contains(owners, Owner(repo)) {
+			continue
+		}
+
+		for event, count := range repoEvents {
+			if len(events) > 0 && !contains(events, event) {
+				continue
+			}
+
+			if _, ok := output[repo]; !ok {
+				output[repo] = map[string]int{}
+			}
+			output[repo][event] = count
+		}
+	}
+
+	return output
+}
+
+// Add merges the provided counts into the receiver
+func (c Counts) Add(other Counts) {
+	for repo, repoEvents := range other {
+		if _, ok := c[repo]; !ok {
+			c[repo] = map[string]int{}
+		}
+
+		for event, count := range repoEvents {
+			c[repo][event] += count
+		}
+	}
+}
+
+// Distinct lists the metrics counting distinct values, such as actors,
+// which cannot be summed across reports
+var Distinct = []string{"actors"}
+
+// WithoutDistinct returns the counts without the Distinct metrics, dropping
+// repositories left without counts
+func (c Counts) WithoutDistinct() Counts {
+	output := Counts{}
+	for repo, repoEvents := range c {
+		for event, count := range repoEvents {
+			if contains(Distinct, event) {
+				continue
+			}
+
+			if _, ok := output[repo]; !ok {
+				output[repo] = map[string]int{}
+			}
+			output[repo][event] = count
+		}
+	}
+
+	return output
+}
+
+// Owner returns the owner portion of an "owner/name" repository key; keys
+// without a name, such as those in organization reports, are returned as is
+func Owner(key string) string {
+	if i := strings.Index(key, "/"); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Query holds filters for retrieving stored report data; Start and End
+// are inclusive and Period selects hourly or rollup report files
+type Query struct {
+	Start  time.Time
+	End    time.Time
+	Period string
+	Report string
+	Repos  []string
+	Owners []string
+	Events []string
+}
+
+// File is the stored form of a report along with the number of archive
+// lines parsed into it and skipped as unreadable
+type File struct {
+	Parsed  int    `json:"parsed"`
+	Skipped int    `json:"skipped"`
+	Counts  Counts `json:"counts"`
+}
+
+// Add merges the provided file's line statistics and counts into the receiver
+func (f *File) Add(other File) {
+	if f.Counts == nil {
+		f.Counts = Counts{}
+	}
+
+	f.Parsed += other.Parsed
+	f.Skipped += other.Skipped
+	f.Counts.Add(other.Counts)
+}
+
+// Report holds the filtered contents of a single stored report file
+type Report struct {
+	Time time.Time `json:"time"`
+	File
 }
 
 // Client implements the S3 interface
@@ -39,10 +173,52 @@ func New() Storage {
 	}
 }
 
+// NewFromConfig generates the Storage implementation for the named backend:
+// "s3" (the default), "filesystem" rooted at the location directory, or
+// "memory" served from the location base URL
+func NewFromConfig(backend, location string) (Storage, error) {
+	switch backend {
+	case "", "s3":
+		return New(), nil
+	case "filesystem":
+		if location == "" {
+			location = "."
+		}
+		return NewFilesystem(location), nil
+	case "memory":
+		return NewMemory(location), nil
+	}
+
+	return nil, fmt.Errorf("unsupported storage backend: %s", backend)
+}
+
+// pathPrefixes returns the listing prefixes for the hourly reports in the
+// rolling window of the current month and the eleven preceding it
+func pathPrefixes(now time.Time) []string {
+	end := now.UTC()
+	start := PeriodStart(Month, end).AddDate(0, -11, 0)
+	return prefixes(Hour, start, end)
+}
+
+// hourKeys returns the hourly report keys among the provided keys
+func hourKeys(keys []string) []string {
+	output := []string{}
+	for _, key := range keys {
+		if _, period, _, ok := parseKey(key); ok && period == Hour {
+			output = append(output, key)
+		}
+	}
+	return output
+}
+
 // PutFile persists a JSON file in S3
 func (c *Client) PutFile(year, month, day, hour int, suffix string, file io.Reader) error {
-	key := fmt.Sprintf("%d/%02d/%02d/%02d/count/%s", year, month, day, hour, uuid.New().String()+"-"+suffix+".json")
+	key := hourKey(time.Date(year, time.Month(month), day, hour, 0, 0, 0, time.UTC), suffix)
+	return c.PutObject(key, file)
+}
 
+// PutObject persists a file in S3 under the key, replacing any previous version
+func (c *Client) PutObject(key string, file io.Reader) error {
 	input := &s3.PutObjectInput{
 		Body:   aws.ReadSeekCloser(file),
 		Bucket: aws.String("comana"),
@@ -57,19 +233,62 @@ func (c *Client) PutFile(year, month, day, hour int, suffix string, file io.Read
 	return nil
 }
 
-var listFiles = func(client s3Client, year, month string, objects *[]*s3.Object) error {
-	output, err := client.ListObjectsV2(&s3.ListObjectsV2Input{
+// GetObject retrieves the file stored in S3 under the key
+func (c *Client) GetObject(key string) (io.Reader, error) {
+	return getFile(c.s3, key)
+}
+
+// DeleteObject removes the file stored in S3 under the key
+func (c *Client) DeleteObject(key string) error {
+	_, err := c.s3.DeleteObject(&s3.DeleteObjectInput{
 		Bucket: aws.String("comana"),
-		Prefix: aws.String(year + "/" + month),
+		Key:    aws.String(key),
 	})
 	if err != nil {
-		return fmt.Errorf("error listing %s/%s files: %s", year, month, err.Error())
+		return fmt.Errorf("error deleting object %s: %s", key, err.Error())
 	}
 
-	*objects = append(*objects, output.Contents...)
 	return nil
 }
 
+// ListKeys retrieves the keys of all files stored in S3 beginning with the prefix
+func (c *Client) ListKeys(prefix string) ([]string, error) {
+	objects := []*s3.Object{}
+	if err := listFiles(c.s3, prefix, &objects); err != nil {
+		return nil, fmt.Errorf("error listing files: %s", err.Error())
+	}
+
+	keys := []string{}
+	for _, object := range objects {
+		keys = append(keys, *object.Key)
+	}
+
+	return keys, nil
+}
+
+// listFiles appends every object beneath the prefix, following continuation
+// tokens past the 1,000 object limit of a single listing call
+var listFiles = func(client s3Client, prefix string, objects *[]*s3.Object) error {
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String("comana"),
+		Prefix: aws.String(prefix),
+	}
+
+	for {
+		output, err := client.ListObjectsV2(input)
+		if err != nil {
+			return fmt.Errorf("error listing %s files: %s", prefix, err.Error())
+		}
+
+		*objects = append(*objects, output.Contents...)
+		if !aws.BoolValue(output.IsTruncated) || output.NextContinuationToken == nil {
+			return nil
+		}
+
+		input.ContinuationToken = output.NextContinuationToken
+	}
+}
+
 var getFile = func(client s3Client, key string) (io.Reader, error) {
 	input := &s3.GetObjectInput{
 		Bucket: aws.String("comana"),
@@ -84,20 +303,187 @@ var getFile = func(client s3Client, key string) (io.Reader, error) {
 	return result.Body, nil
 }
 
-// GetPaths retrieves paths for files stored in S3
-func (c *Client) GetPaths() ([]string, error) {
-	current := time.Now()
-	year := current.Year()
-	month := int(current.Month())
+// PutRollup persists a JSON report file covering the day, week, or month
+// beginning at the provided time in S3, replacing any previous version
+func (c *Client) PutRollup(period string, t time.Time, suffix string, file io.Reader) error {
+	key, err := rollupKey(period, t, suffix)
+	if err != nil {
+		return err
+	}
 
-	objects := []*s3.Object{}
+	return c.PutObject(key, file)
+}
 
-	if err := listFiles(c.s3, strconv.Itoa(year), "", &objects); err != nil {
-		return nil, fmt.Errorf("error listing files: %s", err.Error())
+// decodeFile reads a stored report file; files written before line
+// statistics were recorded contain only the counts object
+func decodeFile(file io.Reader) (File, error) {
+	if closer, ok := file.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	raw := map[string]json.RawMessage{}
+	if err := json.NewDecoder(file).Decode(&raw); err != nil {
+		return File{}, err
+	}
+
+	output := File{}
+	if _, ok := raw["counts"]; !ok {
+		counts := Counts{}
+		for key, value := range raw {
+			events := map[string]int{}
+			if err := json.Unmarshal(value, &events); err != nil {
+				return File{}, err
+			}
+			counts[key] = events
+		}
+		output.Counts = counts
+		return output, nil
+	}
+
+	for key, value := range map[string]interface{}{
+		"parsed":  &output.Parsed,
+		"skipped": &output.Skipped,
+		"counts":  &output.Counts,
+	} {
+		if data, ok := raw[key]; ok {
+			if err := json.Unmarshal(data, value); err != nil {
+				return File{}, err
+			}
+		}
+	}
+
+	return output, nil
+}
+
+// reportWindow validates the query period and returns it along with the
+// beginning of the first matching period
+func reportWindow(q Query) (string, time.Time, error) {
+	period := q.Period
+	if period == "" {
+		period = Hour
+	}
+
+	if !ValidPeriod(period) {
+		return "", time.Time{}, fmt.Errorf("invalid report period: %s", period)
+	}
+
+	return period, PeriodStart(period, q.Start), nil
+}
+
+// collectReports retrieves, decodes, and filters the report files among
+// the provided keys which match the query
+func collectReports(keys []string, q Query, get func(string) (io.Reader, error)) ([]Report, error) {
+	period, start, err := reportWindow(q)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := []Report{}
+	for _, key := range keys {
+		t, keyPeriod, suffix, ok := parseKey(key)
+		if !ok || keyPeriod != period || suffix != q.Report || t.Before(start) || t.After(q.End) {
+			continue
+		}
+
+		file, err := get(key)
+		if err != nil {
+			return nil, fmt.Errorf("error getting file: %s", err.Error())
+		}
+
+		f, err := decodeFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding file %s: %s", key, err.Error())
+		}
+
+		f.Counts = f.Counts.Filter(q.Repos, q.Owners, q.Events)
+		reports = append(reports, Report{
+			Time: t,
+			File: f,
+		})
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Time.Before(reports[j].Time)
+	})
+
+	return reports, nil
+}
+
+// SumReports adds up the report files matching the query, decoding one
+// file at a time so that only the sum is held in memory rather than every
+// file as GetReports returns them
+func SumReports(s Storage, q Query) (File, error) {
+	period, start, err := reportWindow(q)
+	if err != nil {
+		return File{}, err
 	}
 
-	for i := 1; i <= 12-month; i++ {
-		if err := listFiles(c.s3, strconv.Itoa(year-1), strconv.Itoa(i), &objects); err != nil {
+	filtered := len(q.Repos) > 0 || len(q.Owners) > 0 || len(q.Events) > 0
+	sum := File{
+		Counts: Counts{},
+	}
+	for _, prefix := range prefixes(period, start, q.End) {
+		keys, err := s.ListKeys(prefix)
+		if err != nil {
+			return File{}, err
+		}
+
+		for _, key := range keys {
+			t, keyPeriod, suffix, ok := parseKey(key)
+			if !ok || keyPeriod != period || suffix != q.Report || t.Before(start) || t.After(q.End) {
+				continue
+			}
+
+			reader, err := s.GetObject(key)
+			if err != nil {
+				return File{}, fmt.Errorf("error getting file: %s", err.Error())
+			}
+
+			file, err := decodeFile(reader)
+			if err != nil {
+				return File{}, fmt.Errorf("error decoding file %s: %s", key, err.Error())
+			}
+
+			if filtered {
+				file.Counts = file.Counts.Filter(q.Repos, q.Owners, q.Events)
+			}
+			sum.Add(file)
+		}
+	}
+
+	return sum, nil
+}
+
+// GetReports retrieves filtered report data stored in S3
+func (c *Client) GetReports(q Query) ([]Report, error) {
+	period, start, err := reportWindow(q)
+	if err != nil {
+		return nil, err
+	}
+
+	if period == Hour && len(q.Repos) > 0 {
+		return indexedReports(c, q)
+	}
+
+	keys := []string{}
+	for _, prefix := range prefixes(period, start, q.End) {
+		prefixKeys, err := c.ListKeys(prefix)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, prefixKeys...)
+	}
+
+	return collectReports(keys, q, c.GetObject)
+}
+
+// GetPaths retrieves presigned URLs for hourly reports stored in S3 over the
+// rolling 12 month window, oldest first
+func (c *Client) GetPaths() ([]string, error) {
+	objects := []*s3.Object{}
+
+	for _, prefix := range pathPrefixes(time.Now()) {
+		if err := listFiles(c.s3, prefix, &objects); err != nil {
 			return nil, fmt.Errorf("error listing files: %s", err.Error())
 		}
 	}
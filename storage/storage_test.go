@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -22,6 +23,46 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestNewFromConfig(t *testing.T) {
+	tests := []struct {
+		desc    string
+		backend string
+		err     string
+	}{
+		{
+			desc:    "default backend",
+			backend: "",
+			err:     "",
+		},
+		{
+			desc:    "filesystem backend",
+			backend: "filesystem",
+			err:     "",
+		},
+		{
+			desc:    "memory backend",
+			backend: "memory",
+			err:     "",
+		},
+		{
+			desc:    "unsupported backend",
+			backend: "tape",
+			err:     "unsupported storage backend: tape",
+		},
+	}
+
+	for _, test := range tests {
+		s, err := NewFromConfig(test.backend, "")
+		if err != nil && err.Error() != test.err {
+			t.Errorf("description: %s, error received: %s, expected: %s", test.desc, err.Error(), test.err)
+		}
+
+		if err == nil && s == nil {
+			t.Errorf("description: %s, no storage implementation returned", test.desc)
+		}
+	}
+}
+
 type storageMock struct {
 	getObjectOutput    *s3.GetObjectOutput
 	getObjectError     error
@@ -31,6 +72,8 @@ type storageMock struct {
 	listObjectsErr     error
 	putObjectOutput    *s3.PutObjectOutput
 	putObjectErr       error
+	deleteObjectOutput *s3.DeleteObjectOutput
+	deleteObjectErr    error
 }
 
 func (mock *storageMock) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
@@ -45,6 +88,10 @@ func (mock *storageMock) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutpu
 	return mock.putObjectOutput, mock.putObjectErr
 }
 
+func (mock *storageMock) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	return mock.deleteObjectOutput, mock.deleteObjectErr
+}
+
 func (mock *storageMock) GetObjectRequest(input *s3.GetObjectInput) (req *request.Request, output *s3.GetObjectOutput) {
 	return mock.getObjectReq, mock.getObjectReqOutput
 }
@@ -124,7 +171,7 @@ func Test_listFiles(t *testing.T) {
 		}
 
 		objects := &[]*s3.Object{}
-		if err := listFiles(c, "1977", "5", objects); err != nil && err.Error() != test.err {
+		if err := listFiles(c, "1977/5", objects); err != nil && err.Error() != test.err {
 			t.Errorf("description: %s, error received: %s, expected: %s", test.desc, err.Error(), test.err)
 		}
 
@@ -134,6 +181,64 @@ func Test_listFiles(t *testing.T) {
 	}
 }
 
+type pagingMock struct {
+	storageMock
+	pages  []*s3.ListObjectsV2Output
+	tokens []*string
+}
+
+func (mock *pagingMock) ListObjectsV2(input *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error) {
+	mock.tokens = append(mock.tokens, input.ContinuationToken)
+	output := mock.pages[0]
+	mock.pages = mock.pages[1:]
+	return output, nil
+}
+
+func Test_listFilesPagination(t *testing.T) {
+	c := &pagingMock{
+		pages: []*s3.ListObjectsV2Output{
+			{
+				Contents: []*s3.Object{
+					{Key: aws.String("1977/05/25/20/count/per-repo-count.json")},
+				},
+				IsTruncated:           aws.Bool(true),
+				NextContinuationToken: aws.String("empire-strikes-back"),
+			},
+			{
+				Contents: []*s3.Object{
+					{Key: aws.String("1977/05/25/21/count/per-repo-count.json")},
+				},
+				IsTruncated: aws.Bool(false),
+			},
+		},
+	}
+
+	objects := &[]*s3.Object{}
+	if err := listFiles(c, "1977/05", objects); err != nil {
+		t.Fatalf("description: paginated listing, error received: %s", err.Error())
+	}
+
+	if len(*objects) != 2 {
+		t.Errorf("description: paginated listing, output length received: %d, expected: 2", len(*objects))
+	}
+
+	if len(c.tokens) != 2 || c.tokens[0] != nil || aws.StringValue(c.tokens[1]) != "empire-strikes-back" {
+		t.Errorf("description: paginated listing, continuation tokens received: %v", c.tokens)
+	}
+}
+
+func Test_pathPrefixes(t *testing.T) {
+	now := time.Date(1977, 5, 25, 20, 0, 0, 0, time.UTC)
+	expected := []string{
+		"1976/06", "1976/07", "1976/08", "1976/09", "1976/10", "1976/11",
+		"1976/12", "1977/01", "1977/02", "1977/03", "1977/04", "1977/05",
+	}
+
+	if output := pathPrefixes(now); !reflect.DeepEqual(output, expected) {
+		t.Errorf("description: rolling window, output received: %v, expected: %v", output, expected)
+	}
+}
+
 func Test_getFile(t *testing.T) {
 	tests := []struct {
 		desc      string
@@ -212,11 +317,16 @@ func TestGetPaths(t *testing.T) {
 				},
 			},
 			getObjectReqOutput: nil,
-			outputLen:          12 - int(time.Now().Month()) + 1, // Due to time.Now() used in GetPaths method
+			outputLen:          12, // one listing per month in the rolling window
 			err:                "",
 		},
 	}
 
+	list := listFiles
+	defer func() {
+		listFiles = list
+	}()
+
 	for _, test := range tests {
 		c := &Client{
 			s3: &storageMock{
@@ -225,7 +335,7 @@ func TestGetPaths(t *testing.T) {
 			},
 		}
 
-		listFiles = func(client s3Client, year, month string, objects *[]*s3.Object) error {
+		listFiles = func(client s3Client, prefix string, objects *[]*s3.Object) error {
 			*objects = append(*objects, &s3.Object{
 				Key: aws.String("test-key"),
 			})
@@ -242,3 +352,468 @@ func TestGetPaths(t *testing.T) {
 		}
 	}
 }
+
+func TestFilter(t *testing.T) {
+	counts := Counts{
+		"luke/x-wing": {
+			"PushEvent":  2,
+			"WatchEvent": 1,
+		},
+		"han/falcon": {
+			"PushEvent": 3,
+		},
+	}
+
+	tests := []struct {
+		desc   string
+		repos  []string
+		owners []string
+		events []string
+		output Counts
+	}{
+		{
+			desc:   "no filters",
+			repos:  nil,
+			events: nil,
+			output: counts,
+		},
+		{
+			desc:   "repository filter",
+			repos:  []string{"han/falcon"},
+			events: nil,
+			output: Counts{
+				"han/falcon": {
+					"PushEvent": 3,
+				},
+			},
+		},
+		{
+			desc:   "owner filter",
+			repos:  nil,
+			owners: []string{"luke"},
+			events: nil,
+			output: Counts{
+				"luke/x-wing": {
+					"PushEvent":  2,
+					"WatchEvent": 1,
+				},
+			},
+		},
+		{
+			desc:   "event filter",
+			repos:  nil,
+			events: []string{"WatchEvent"},
+			output: Counts{
+				"luke/x-wing": {
+					"WatchEvent": 1,
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		output := counts.Filter(test.repos, test.owners, test.events)
+		if !reflect.DeepEqual(output, test.output) {
+			t.Errorf("description: %s, output received: %+v, expected: %+v", test.desc, output, test.output)
+		}
+	}
+}
+
+func TestGetReports(t *testing.T) {
+	tests := []struct {
+		desc    string
+		period  string
+		listErr error
+		getOut  io.Reader
+		getErr  error
+		repos   []string
+		reports int
+		err     string
+	}{
+		{
+			desc:    "invalid period",
+			period:  "decade",
+			listErr: nil,
+			getOut:  nil,
+			getErr:  nil,
+			reports: 0,
+			err:     "invalid report period: decade",
+		},
+		{
+			desc:    "list files error",
+			listErr: errors.New("listing error"),
+			getOut:  nil,
+			getErr:  nil,
+			reports: 0,
+			err:     "error listing files: listing error",
+		},
+		{
+			desc:    "get file error",
+			listErr: nil,
+			getOut:  nil,
+			getErr:  errors.New("get error"),
+			reports: 0,
+			err:     "error getting file: get error",
+		},
+		{
+			desc:    "decode file error",
+			listErr: nil,
+			getOut:  strings.NewReader("not-json"),
+			getErr:  nil,
+			reports: 0,
+			err:     "error decoding file 1977/05/25/20/count/per-repo-count.json: invalid character 'o' in literal null (expecting 'u')",
+		},
+		{
+			desc:    "successful invocation",
+			listErr: nil,
+			getOut:  strings.NewReader(`{"luke/x-wing":{"PushEvent":1},"han/falcon":{"PushEvent":2}}`),
+			getErr:  nil,
+			repos:   []string{"han/falcon"},
+			reports: 1,
+			err:     "",
+		},
+	}
+
+	list, get := listFiles, getFile
+	defer func() {
+		listFiles, getFile = list, get
+	}()
+
+	for _, test := range tests {
+		c := &Client{
+			s3: &storageMock{},
+		}
+
+		listFiles = func(client s3Client, prefix string, objects *[]*s3.Object) error {
+			*objects = append(*objects,
+				&s3.Object{
+					Key: aws.String("1977/05/25/20/count/per-repo-count.json"),
+				},
+				&s3.Object{
+					Key: aws.String("1977/05/25/20/count/other-report.json"),
+				},
+				&s3.Object{
+					Key: aws.String("1977/05/26/20/count/per-repo-count.json"),
+				},
+			)
+			return test.listErr
+		}
+
+		getFile = func(client s3Client, key string) (io.Reader, error) {
+			return test.getOut, test.getErr
+		}
+
+		q := Query{
+			Start:  time.Date(1977, 5, 25, 0, 0, 0, 0, time.UTC),
+			End:    time.Date(1977, 5, 25, 23, 0, 0, 0, time.UTC),
+			Period: test.period,
+			Report: "per-repo-count",
+			Repos:  test.repos,
+		}
+
+		reports, err := c.GetReports(q)
+		if err != nil && err.Error() != test.err {
+			t.Errorf("description: %s, error received: %s, expected: %s", test.desc, err.Error(), test.err)
+		}
+
+		if len(reports) != test.reports {
+			t.Errorf("description: %s, reports received: %d, expected: %d", test.desc, len(reports), test.reports)
+		}
+
+		if len(reports) == 1 && len(reports[0].Counts) != len(test.repos) {
+			t.Errorf("description: %s, repositories received: %d, expected: %d", test.desc, len(reports[0].Counts), len(test.repos))
+		}
+	}
+}
+
+func TestAdd(t *testing.T) {
+	counts := Counts{
+		"luke/x-wing": {
+			"PushEvent": 2,
+		},
+	}
+
+	counts.Add(Counts{
+		"luke/x-wing": {
+			"PushEvent":  1,
+			"WatchEvent": 1,
+		},
+		"han/falcon": {
+			"PushEvent": 3,
+		},
+	})
+
+	expected := Counts{
+		"luke/x-wing": {
+			"PushEvent":  3,
+			"WatchEvent": 1,
+		},
+		"han/falcon": {
+			"PushEvent": 3,
+		},
+	}
+
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("description: merged counts, output received: %+v, expected: %+v", counts, expected)
+	}
+}
+
+func TestSumReports(t *testing.T) {
+	m := NewMemory("")
+	m.PutFile(1977, 5, 25, 20, "per-repo-count", strings.NewReader(`{"parsed":2,"skipped":1,"counts":{"luke/x-wing":{"PushEvent":1},"han/falcon":{"ForkEvent":1}}}`))
+	m.PutFile(1977, 5, 25, 21, "per-repo-count", strings.NewReader(`{"parsed":3,"skipped":0,"counts":{"luke/x-wing":{"PushEvent":2}}}`))
+	m.PutFile(1977, 5, 26, 0, "per-repo-count", strings.NewReader(`{"parsed":9,"skipped":0,"counts":{"luke/x-wing":{"PushEvent":9}}}`))
+	m.PutFile(1977, 5, 25, 22, "per-org-count", strings.NewReader(`{"luke":{"PushEvent":9}}`))
+
+	q := Query{
+		Start:  time.Date(1977, 5, 25, 0, 0, 0, 0, time.UTC),
+		End:    time.Date(1977, 5, 25, 23, 0, 0, 0, time.UTC),
+		Period: Hour,
+		Report: "per-repo-count",
+	}
+
+	output, err := SumReports(m, q)
+	expected := File{
+		Parsed:  5,
+		Skipped: 1,
+		Counts: Counts{
+			"luke/x-wing": {"PushEvent": 3},
+			"han/falcon":  {"ForkEvent": 1},
+		},
+	}
+	if err != nil || !reflect.DeepEqual(output, expected) {
+		t.Errorf("description: summed reports, output received: %+v %v, expected: %+v", output, err, expected)
+	}
+
+	q.Owners = []string{"han"}
+	if output, err := SumReports(m, q); err != nil || len(output.Counts) != 1 || output.Counts["han/falcon"]["ForkEvent"] != 1 {
+		t.Errorf("description: filtered sum, output received: %+v %v", output, err)
+	}
+
+	q.Period = "decade"
+	if _, err := SumReports(m, q); err == nil {
+		t.Errorf("description: invalid period, error received: nil")
+	}
+}
+
+func TestWithoutDistinct(t *testing.T) {
+	counts := Counts{
+		"luke/x-wing": {
+			"commits": 3,
+			"actors":  2,
+		},
+		"han/falcon": {
+			"actors": 1,
+		},
+	}
+
+	expected := Counts{
+		"luke/x-wing": {
+			"commits": 3,
+		},
+	}
+
+	if output := counts.WithoutDistinct(); !reflect.DeepEqual(output, expected) {
+		t.Errorf("description: distinct counts removed, output received: %+v, expected: %+v", output, expected)
+	}
+}
+
+func TestPutRollup(t *testing.T) {
+	tests := []struct {
+		desc       string
+		period     string
+		storageErr error
+		err        string
+	}{
+		{
+			desc:       "invalid period",
+			period:     "decade",
+			storageErr: nil,
+			err:        "invalid rollup period: decade",
+		},
+		{
+			desc:       "s3 client error",
+			period:     Day,
+			storageErr: errors.New("mock storage error"),
+			err:        "error putting file: mock storage error",
+		},
+		{
+			desc:       "successful invocation",
+			period:     Week,
+			storageErr: nil,
+			err:        "",
+		},
+	}
+
+	for _, test := range tests {
+		c := &Client{
+			s3: &storageMock{
+				putObjectOutput: &s3.PutObjectOutput{},
+				putObjectErr:    test.storageErr,
+			},
+		}
+
+		if err := c.PutRollup(test.period, time.Date(1980, 5, 21, 0, 0, 0, 0, time.UTC), "vi", strings.NewReader("test")); err != nil && err.Error() != test.err {
+			t.Errorf("description: %s, error received: %s, expected: %s", test.desc, err.Error(), test.err)
+		}
+	}
+}
+
+func TestOwner(t *testing.T) {
+	tests := []struct {
+		desc   string
+		key    string
+		output string
+	}{
+		{
+			desc:   "repository key",
+			key:    "rebels/x-wing",
+			output: "rebels",
+		},
+		{
+			desc:   "organization key",
+			key:    "rebels",
+			output: "rebels",
+		},
+	}
+
+	for _, test := range tests {
+		if output := Owner(test.key); output != test.output {
+			t.Errorf("description: %s, output received: %s, expected: %s", test.desc, output, test.output)
+		}
+	}
+}
+
+func Test_decodeFile(t *testing.T) {
+	tests := []struct {
+		desc   string
+		file   io.Reader
+		output File
+		err    string
+	}{
+		{
+			desc:   "invalid file",
+			file:   strings.NewReader("not-json"),
+			output: File{},
+			err:    "invalid character 'o' in literal null (expecting 'u')",
+		},
+		{
+			desc: "legacy counts file",
+			file: strings.NewReader(`{"luke/x-wing":{"PushEvent":1}}`),
+			output: File{
+				Counts: Counts{
+					"luke/x-wing": {
+						"PushEvent": 1,
+					},
+				},
+			},
+			err: "",
+		},
+		{
+			desc: "file with line statistics",
+			file: strings.NewReader(`{"parsed":2,"skipped":1,"counts":{"luke/x-wing":{"PushEvent":2}}}`),
+			output: File{
+				Parsed:  2,
+				Skipped: 1,
+				Counts: Counts{
+					"luke/x-wing": {
+						"PushEvent": 2,
+					},
+				},
+			},
+			err: "",
+		},
+	}
+
+	for _, test := range tests {
+		output, err := decodeFile(test.file)
+		if err != nil && err.Error() != test.err {
+			t.Errorf("description: %s, error received: %s, expected: %s", test.desc, err.Error(), test.err)
+		}
+
+		if !reflect.DeepEqual(output, test.output) {
+			t.Errorf("description: %s, output received: %+v, expected: %+v", test.desc, output, test.output)
+		}
+	}
+}
+
+func TestListKeys(t *testing.T) {
+	tests := []struct {
+		desc       string
+		listOutput *s3.ListObjectsV2Output
+		listErr    error
+		keys       []string
+		err        string
+	}{
+		{
+			desc:       "s3 client error",
+			listOutput: nil,
+			listErr:    errors.New("mock storage error"),
+			keys:       nil,
+			err:        "error listing files: error listing jobs/ files: mock storage error",
+		},
+		{
+			desc: "successful invocation",
+			listOutput: &s3.ListObjectsV2Output{
+				Contents: []*s3.Object{
+					{
+						Key: aws.String("jobs/a-new-hope.json"),
+					},
+				},
+			},
+			listErr: nil,
+			keys:    []string{"jobs/a-new-hope.json"},
+			err:     "",
+		},
+	}
+
+	for _, test := range tests {
+		c := &Client{
+			s3: &storageMock{
+				listObjectsOutput: test.listOutput,
+				listObjectsErr:    test.listErr,
+			},
+		}
+
+		keys, err := c.ListKeys("jobs/")
+		if err != nil && err.Error() != test.err {
+			t.Errorf("description: %s, error received: %s, expected: %s", test.desc, err.Error(), test.err)
+		}
+
+		if err == nil && !reflect.DeepEqual(keys, test.keys) {
+			t.Errorf("description: %s, keys received: %v, expected: %v", test.desc, keys, test.keys)
+		}
+	}
+}
+
+func TestDeleteObject(t *testing.T) {
+	tests := []struct {
+		desc      string
+		deleteErr error
+		err       string
+	}{
+		{
+			desc:      "s3 client error",
+			deleteErr: errors.New("mock storage error"),
+			err:       "error deleting object key: mock storage error",
+		},
+		{
+			desc:      "successful invocation",
+			deleteErr: nil,
+			err:       "",
+		},
+	}
+
+	for _, test := range tests {
+		c := &Client{
+			s3: &storageMock{
+				deleteObjectOutput: &s3.DeleteObjectOutput{},
+				deleteObjectErr:    test.deleteErr,
+			},
+		}
+
+		if err := c.DeleteObject("key"); err != nil && err.Error() != test.err {
+			t.Errorf("description: %s, error received: %s, expected: %s", test.desc, err.Error(), test.err)
+		}
+	}
+}
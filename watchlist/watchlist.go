@@ -0,0 +1,218 @@
+// Package watchlist persists named sets of watched repositories and
+// organizations through the storage package
+package watchlist
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/forstmeier/comana/storage"
+)
+
+// prefix is the storage key prefix of watchlist files
+const prefix = "watchlist/"
+
+// validName restricts watchlist names to characters safe in storage keys
+// and report names
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// ErrNotFound is returned for watchlists which have not been created
+var ErrNotFound = errors.New("watchlist not found")
+
+// Watchlist holds the repositories and owners, either organizations or
+// users, watched under a name
+type Watchlist struct {
+	Name   string   `json:"name"`
+	Repos  []string `json:"repos"`
+	Owners []string `json:"owners"`
+}
+
+// Report returns the name of the hourly report holding the watchlist's
+// entities
+func (w Watchlist) Report() string {
+	return "watchlist-" + w.Name
+}
+
+// Watches reports whether the repository, or its owner, is watched
+func (w Watchlist) Watches(repo string) bool {
+	for _, r := range w.Repos {
+		if r == repo {
+			return true
+		}
+	}
+
+	owner := storage.Owner(repo)
+	for _, o := range w.Owners {
+		if o == owner {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Filter returns the subset of counts for watched repositories
+func (w Watchlist) Filter(counts storage.Counts) storage.Counts {
+	output := storage.Counts{}
+	for repo, events := range counts {
+		if w.Watches(repo) {
+			output[repo] = events
+		}
+	}
+	return output
+}
+
+// Add watches the repositories and owners
+func (w *Watchlist) Add(repos, owners []string) {
+	w.Repos = union(w.Repos, repos)
+	w.Owners = union(w.Owners, owners)
+}
+
+// Remove stops watching the repositories and owners
+func (w *Watchlist) Remove(repos, owners []string) {
+	w.Repos = difference(w.Repos, repos)
+	w.Owners = difference(w.Owners, owners)
+}
+
+func union(values, added []string) []string {
+	set := map[string]bool{}
+	for _, value := range append(values, added...) {
+		if value = strings.TrimSpace(value); value != "" {
+			set[value] = true
+		}
+	}
+	return sorted(set)
+}
+
+func difference(values, removed []string) []string {
+	set := map[string]bool{}
+	for _, value := range values {
+		set[value] = true
+	}
+	for _, value := range removed {
+		delete(set, strings.TrimSpace(value))
+	}
+	return sorted(set)
+}
+
+func sorted(set map[string]bool) []string {
+	output := []string{}
+	for value := range set {
+		output = append(output, value)
+	}
+	sort.Strings(output)
+	return output
+}
+
+func key(name string) string {
+	return prefix + name + ".json"
+}
+
+// ValidName reports whether the name may be used for a watchlist
+func ValidName(name string) bool {
+	return validName.MatchString(name)
+}
+
+// Names returns the names of every stored watchlist
+func Names(s storage.Storage) ([]string, error) {
+	keys, err := s.ListKeys(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, k := range keys {
+		if name := strings.TrimSuffix(strings.TrimPrefix(k, prefix), ".json"); ValidName(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Get retrieves the named watchlist, returning ErrNotFound when it does
+// not exist
+func Get(s storage.Storage, name string) (Watchlist, error) {
+	keys, err := s.ListKeys(key(name))
+	if err != nil {
+		return Watchlist{}, err
+	}
+
+	for _, k := range keys {
+		if k == key(name) {
+			return get(s, name)
+		}
+	}
+
+	return Watchlist{}, ErrNotFound
+}
+
+func get(s storage.Storage, name string) (Watchlist, error) {
+	reader, err := s.GetObject(key(name))
+	if err != nil {
+		return Watchlist{}, err
+	}
+
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	w := Watchlist{}
+	if err := json.NewDecoder(reader).Decode(&w); err != nil {
+		return Watchlist{}, fmt.Errorf("error decoding watchlist %s: %s", name, err.Error())
+	}
+
+	return w, nil
+}
+
+// All retrieves every stored watchlist ordered by name
+func All(s storage.Storage) ([]Watchlist, error) {
+	names, err := Names(s)
+	if err != nil {
+		return nil, err
+	}
+
+	output := []Watchlist{}
+	for _, name := range names {
+		w, err := get(s, name)
+		if err != nil {
+			return nil, err
+		}
+		output = append(output, w)
+	}
+
+	return output, nil
+}
+
+// Put stores the watchlist, replacing any previous version
+func Put(s storage.Storage, w Watchlist) error {
+	if !ValidName(w.Name) {
+		return errors.New("invalid watchlist name: " + w.Name)
+	}
+
+	if w.Repos == nil {
+		w.Repos = []string{}
+	}
+	if w.Owners == nil {
+		w.Owners = []string{}
+	}
+
+	b, err := json.Marshal(w)
+	if err != nil {
+		return err
+	}
+
+	return s.PutObject(key(w.Name), bytes.NewReader(b))
+}
+
+// Delete removes the named watchlist
+func Delete(s storage.Storage, name string) error {
+	return s.DeleteObject(key(name))
+}
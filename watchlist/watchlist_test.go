@@ -0,0 +1,79 @@
+package watchlist
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/forstmeier/comana/storage"
+)
+
+func TestWatchlist(t *testing.T) {
+	w := Watchlist{
+		Name: "rebels",
+	}
+	w.Add([]string{"luke/x-wing", " han/falcon", "luke/x-wing"}, []string{"kubernetes"})
+	w.Remove([]string{"han/falcon"}, nil)
+
+	expected := Watchlist{
+		Name:   "rebels",
+		Repos:  []string{"luke/x-wing"},
+		Owners: []string{"kubernetes"},
+	}
+	if !reflect.DeepEqual(w, expected) {
+		t.Errorf("description: add and remove, output received: %+v, expected: %+v", w, expected)
+	}
+
+	counts := storage.Counts{
+		"luke/x-wing":           {"PushEvent": 1},
+		"luke/landspeeder":      {"PushEvent": 2},
+		"kubernetes/kubernetes": {"WatchEvent": 3},
+	}
+	filtered := storage.Counts{
+		"luke/x-wing":           {"PushEvent": 1},
+		"kubernetes/kubernetes": {"WatchEvent": 3},
+	}
+	if output := w.Filter(counts); !reflect.DeepEqual(output, filtered) {
+		t.Errorf("description: filter counts, output received: %+v, expected: %+v", output, filtered)
+	}
+
+	if report := w.Report(); report != "watchlist-rebels" {
+		t.Errorf("description: report name, output received: %s, expected: watchlist-rebels", report)
+	}
+}
+
+func TestStorage(t *testing.T) {
+	s := storage.NewMemory("")
+
+	if err := Put(s, Watchlist{Name: "Rebels!"}); err == nil || err.Error() != "invalid watchlist name: Rebels!" {
+		t.Errorf("description: invalid name, error received: %v", err)
+	}
+
+	if _, err := Get(s, "rebels"); err != ErrNotFound {
+		t.Errorf("description: missing watchlist, error received: %v, expected: %s", err, ErrNotFound)
+	}
+
+	for _, name := range []string{"rebels", "empire"} {
+		if err := Put(s, Watchlist{Name: name, Repos: []string{name + "/base"}}); err != nil {
+			t.Fatalf("description: put watchlist, error received: %s", err.Error())
+		}
+	}
+
+	w, err := Get(s, "rebels")
+	if err != nil {
+		t.Fatalf("description: get watchlist, error received: %s", err.Error())
+	}
+
+	expected := Watchlist{Name: "rebels", Repos: []string{"rebels/base"}, Owners: []string{}}
+	if !reflect.DeepEqual(w, expected) {
+		t.Errorf("description: get watchlist, output received: %+v, expected: %+v", w, expected)
+	}
+
+	if err := Delete(s, "empire"); err != nil {
+		t.Fatalf("description: delete watchlist, error received: %s", err.Error())
+	}
+
+	all, err := All(s)
+	if err != nil || len(all) != 1 || all[0].Name != "rebels" {
+		t.Errorf("description: all watchlists, output received: %+v, error received: %v", all, err)
+	}
+}
@@ -0,0 +1,290 @@
+// Package webhook delivers signed report payloads to subscriber URLs and
+// keeps dead-letter records of failed deliveries
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/forstmeier/comana/storage"
+)
+
+// Storage key prefixes of subscriptions and dead-letter records
+const (
+	subscriptionPrefix = "webhooks/subscriptions/"
+	deadLetterPrefix   = "webhooks/dead-letters/"
+)
+
+// SignatureHeader holds the hex encoded HMAC-SHA256 of the request body
+// keyed with the subscription secret, prefixed with "sha256="
+const SignatureHeader = "X-Comana-Signature"
+
+// Subscription holds a webhook URL along with the secret used to sign its
+// payloads; Repos optionally limits the payload counts
+type Subscription struct {
+	ID     string   `json:"id"`
+	URL    string   `json:"url"`
+	Secret string   `json:"secret,omitempty"`
+	Repos  []string `json:"repos"`
+}
+
+// Payload is the JSON document posted to subscribers for a saved hour
+type Payload struct {
+	Subscription string         `json:"subscription"`
+	Time         time.Time      `json:"time"`
+	Report       string         `json:"report"`
+	Counts       storage.Counts `json:"counts"`
+}
+
+// DeadLetter records a payload which could not be delivered
+type DeadLetter struct {
+	Subscription string          `json:"subscription"`
+	URL          string          `json:"url"`
+	Attempts     int             `json:"attempts"`
+	Error        string          `json:"error"`
+	Time         time.Time       `json:"time"`
+	Payload      json.RawMessage `json:"payload"`
+}
+
+// Sign returns the signature header value for the body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sender posts payloads, retrying failed attempts after a backoff which
+// doubles with each attempt; client errors other than 429 are not retried
+// and no retry is started which would end after the context deadline
+type Sender struct {
+	Client   *http.Client
+	Attempts int
+	Backoff  time.Duration
+	sleep    func(time.Duration)
+}
+
+// NewSender generates a Sender making up to five attempts
+func NewSender() *Sender {
+	return &Sender{
+		Client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		Attempts: 5,
+		Backoff:  time.Second,
+		sleep:    time.Sleep,
+	}
+}
+
+// Send posts the signed body to the subscription URL, returning the number
+// of attempts made along with the final error
+func (s *Sender) Send(ctx context.Context, sub Subscription, body []byte) (int, error) {
+	var err error
+	backoff := s.Backoff
+
+	for attempt := 1; attempt <= s.Attempts; attempt++ {
+		var retry bool
+		if retry, err = s.post(ctx, sub, body); err == nil || !retry {
+			return attempt, err
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(backoff).After(deadline) {
+			return attempt, err
+		}
+
+		if attempt < s.Attempts && s.sleep != nil {
+			s.sleep(backoff)
+			backoff *= 2
+		}
+	}
+
+	return s.Attempts, err
+}
+
+// post makes a single delivery attempt, reporting whether a failure may
+// succeed on retry
+func (s *Sender) post(ctx context.Context, sub Subscription, body []byte) (bool, error) {
+	req, err := http.NewRequest("POST", sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(sub.Secret, body))
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return false, nil
+	}
+
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, sub.URL)
+}
+
+// Deliver sends the payload to the subscription before the context is
+// done, storing a dead-letter record when every attempt fails
+func Deliver(ctx context.Context, s storage.Storage, sender *Sender, sub Subscription, p Payload) error {
+	p.Subscription = sub.ID
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	attempts, err := sender.Send(ctx, sub, body)
+	if err == nil {
+		return nil
+	}
+
+	b, marshalErr := json.Marshal(DeadLetter{
+		Subscription: sub.ID,
+		URL:          sub.URL,
+		Attempts:     attempts,
+		Error:        err.Error(),
+		Time:         time.Now().UTC(),
+		Payload:      body,
+	})
+	if marshalErr != nil {
+		return marshalErr
+	}
+
+	key := fmt.Sprintf("%s%s/%s-%s.json", deadLetterPrefix, sub.ID, p.Time.Format("2006-01-02T15"), uuid.New().String())
+	if putErr := s.PutObject(key, bytes.NewReader(b)); putErr != nil {
+		return fmt.Errorf("error storing dead letter after %s: %s", err.Error(), putErr.Error())
+	}
+
+	return fmt.Errorf("error delivering to %s after %d attempts: %s", sub.ID, attempts, err.Error())
+}
+
+// Subscribe validates and stores a new subscription under a generated ID;
+// a random secret is generated when none is provided so that every payload
+// is signed with a key known only to the subscriber
+func Subscribe(s storage.Storage, sub Subscription) (Subscription, error) {
+	u, err := url.Parse(sub.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Subscription{}, errors.New("invalid url: " + sub.URL)
+	}
+
+	if sub.Secret == "" {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return Subscription{}, fmt.Errorf("error generating secret: %s", err.Error())
+		}
+		sub.Secret = hex.EncodeToString(key)
+	}
+
+	sub.ID = uuid.New().String()
+	if sub.Repos == nil {
+		sub.Repos = []string{}
+	}
+
+	b, err := json.Marshal(sub)
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	if err := s.PutObject(subscriptionPrefix+sub.ID+".json", bytes.NewReader(b)); err != nil {
+		return Subscription{}, err
+	}
+
+	return sub, nil
+}
+
+// Unsubscribe removes the subscription
+func Unsubscribe(s storage.Storage, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return errors.New("invalid subscription id: " + id)
+	}
+
+	return s.DeleteObject(subscriptionPrefix + id + ".json")
+}
+
+// Subscriptions retrieves every stored subscription ordered by ID
+func Subscriptions(s storage.Storage) ([]Subscription, error) {
+	output := []Subscription{}
+	err := decodeAll(s, subscriptionPrefix, func(decoder *json.Decoder) error {
+		sub := Subscription{}
+		if err := decoder.Decode(&sub); err != nil {
+			return err
+		}
+		output = append(output, sub)
+		return nil
+	})
+
+	sort.Slice(output, func(i, j int) bool {
+		return output[i].ID < output[j].ID
+	})
+
+	return output, err
+}
+
+// DeadLetters retrieves the dead-letter records of the subscription, or of
+// every subscription when the ID is empty, oldest first
+func DeadLetters(s storage.Storage, id string) ([]DeadLetter, error) {
+	if _, err := uuid.Parse(id); id != "" && err != nil {
+		return nil, errors.New("invalid subscription id: " + id)
+	}
+
+	output := []DeadLetter{}
+	err := decodeAll(s, deadLetterPrefix+id, func(decoder *json.Decoder) error {
+		letter := DeadLetter{}
+		if err := decoder.Decode(&letter); err != nil {
+			return err
+		}
+		output = append(output, letter)
+		return nil
+	})
+
+	sort.Slice(output, func(i, j int) bool {
+		return output[i].Time.Before(output[j].Time)
+	})
+
+	return output, err
+}
+
+// decodeAll passes a decoder for every JSON file beneath the prefix to fn
+func decodeAll(s storage.Storage, prefix string, fn func(*json.Decoder) error) error {
+	keys, err := s.ListKeys(prefix)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if !strings.HasSuffix(key, ".json") {
+			continue
+		}
+
+		reader, err := s.GetObject(key)
+		if err != nil {
+			return err
+		}
+
+		err = fn(json.NewDecoder(reader))
+		if closer, ok := reader.(io.Closer); ok {
+			closer.Close()
+		}
+		if err != nil {
+			return fmt.Errorf("error decoding %s: %s", key, err.Error())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,199 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/forstmeier/comana/storage"
+)
+
+func TestSign(t *testing.T) {
+	expected := "sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"
+	if output := Sign("key", []byte("The quick brown fox jumps over the lazy dog")); output != expected {
+		t.Errorf("description: known signature, output received: %s, expected: %s", output, expected)
+	}
+}
+
+func testSender() (*Sender, *[]time.Duration) {
+	sleeps := []time.Duration{}
+	return &Sender{
+		Client:   http.DefaultClient,
+		Attempts: 4,
+		Backoff:  time.Second,
+		sleep: func(d time.Duration) {
+			sleeps = append(sleeps, d)
+		},
+	}, &sleeps
+}
+
+func TestSend(t *testing.T) {
+	tests := []struct {
+		desc     string
+		timeout  time.Duration
+		statuses []int
+		attempts int
+		sleeps   []time.Duration
+		err      string
+	}{
+		{
+			desc:     "retried until delivered",
+			statuses: []int{500, 429, 200},
+			attempts: 3,
+			sleeps:   []time.Duration{time.Second, 2 * time.Second},
+			err:      "",
+		},
+		{
+			desc:     "client error not retried",
+			statuses: []int{400},
+			attempts: 1,
+			sleeps:   []time.Duration{},
+			err:      "unexpected status code 400 from ",
+		},
+		{
+			desc:     "attempts exhausted",
+			statuses: []int{503, 503, 503, 503},
+			attempts: 4,
+			sleeps:   []time.Duration{time.Second, 2 * time.Second, 4 * time.Second},
+			err:      "unexpected status code 503 from ",
+		},
+		{
+			desc:     "retries stopped by deadline",
+			timeout:  time.Minute + 30*time.Second,
+			statuses: []int{503, 503, 503, 503},
+			attempts: 2,
+			sleeps:   []time.Duration{time.Minute},
+			err:      "unexpected status code 503 from ",
+		},
+	}
+
+	for _, test := range tests {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			if r.Header.Get(SignatureHeader) != Sign("test-secret", body) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			w.WriteHeader(test.statuses[requests])
+			requests++
+		}))
+
+		ctx, cancel := context.Background(), func() {}
+		if test.timeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, test.timeout)
+		}
+
+		sender, sleeps := testSender()
+		if test.timeout > 0 {
+			sender.Backoff = time.Minute
+		}
+		attempts, err := sender.Send(ctx, Subscription{URL: server.URL, Secret: "test-secret"}, []byte(`{"counts":{}}`))
+		cancel()
+		server.Close()
+
+		if err != nil && err.Error() != test.err+server.URL {
+			t.Errorf("description: %s, error received: %s, expected: %s", test.desc, err.Error(), test.err+server.URL)
+		}
+
+		if (err == nil) != (test.err == "") {
+			t.Errorf("description: %s, error received: %v, expected: %s", test.desc, err, test.err)
+		}
+
+		if attempts != test.attempts || !reflect.DeepEqual(*sleeps, test.sleeps) {
+			t.Errorf("description: %s, attempts received: %d %v, expected: %d %v", test.desc, attempts, *sleeps, test.attempts, test.sleeps)
+		}
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	s := storage.NewMemory("")
+	received := Payload{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone" {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer server.Close()
+
+	now := time.Date(1977, 5, 25, 20, 0, 0, 0, time.UTC)
+	p := Payload{
+		Time:   now,
+		Report: "per-repo-count",
+		Counts: storage.Counts{"luke/x-wing": {"PushEvent": 1}},
+	}
+
+	sub, err := Subscribe(s, Subscription{URL: server.URL, Secret: "test-secret"})
+	if err != nil {
+		t.Fatalf("description: subscribe, error received: %s", err.Error())
+	}
+
+	sender, _ := testSender()
+	if err := Deliver(context.Background(), s, sender, sub, p); err != nil {
+		t.Fatalf("description: successful delivery, error received: %s", err.Error())
+	}
+
+	if received.Subscription != sub.ID || received.Counts["luke/x-wing"]["PushEvent"] != 1 {
+		t.Errorf("description: successful delivery, payload received: %+v", received)
+	}
+
+	gone := Subscription{ID: "00000000-0000-0000-0000-000000000001", URL: server.URL + "/gone"}
+	if err := Deliver(context.Background(), s, sender, gone, p); err == nil {
+		t.Errorf("description: failed delivery, error received: nil")
+	}
+
+	letters, err := DeadLetters(s, gone.ID)
+	if err != nil {
+		t.Fatalf("description: dead letters, error received: %s", err.Error())
+	}
+
+	if len(letters) != 1 || letters[0].Attempts != 1 || letters[0].URL != gone.URL {
+		t.Errorf("description: dead letters, output received: %+v", letters)
+	}
+
+	if all, _ := DeadLetters(s, ""); len(all) != 1 {
+		t.Errorf("description: all dead letters, output received: %+v", all)
+	}
+}
+
+func TestSubscriptions(t *testing.T) {
+	s := storage.NewMemory("")
+
+	if _, err := Subscribe(s, Subscription{URL: "ftp://example.com"}); err == nil || err.Error() != "invalid url: ftp://example.com" {
+		t.Errorf("description: invalid url, error received: %v", err)
+	}
+
+	sub, err := Subscribe(s, Subscription{URL: "https://example.com/hook", Repos: []string{"luke/x-wing"}})
+	if err != nil {
+		t.Fatalf("description: subscribe, error received: %s", err.Error())
+	}
+
+	if len(sub.Secret) != 64 {
+		t.Errorf("description: generated secret, secret received: %q", sub.Secret)
+	}
+
+	subs, err := Subscriptions(s)
+	if err != nil || len(subs) != 1 || !reflect.DeepEqual(subs[0], sub) {
+		t.Errorf("description: list subscriptions, output received: %+v, error received: %v", subs, err)
+	}
+
+	if err := Unsubscribe(s, "../watchlist/rebels"); err == nil {
+		t.Errorf("description: invalid id, error received: nil")
+	}
+
+	if err := Unsubscribe(s, sub.ID); err != nil {
+		t.Fatalf("description: unsubscribe, error received: %s", err.Error())
+	}
+
+	if subs, _ := Subscriptions(s); len(subs) != 0 {
+		t.Errorf("description: unsubscribe, output received: %+v", subs)
+	}
+}